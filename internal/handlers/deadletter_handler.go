@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/taskforge"
+)
+
+// DeadLetterHandler manages dead letter queue operations.
+type DeadLetterHandler struct {
+	Manager *taskforge.Manager
+}
+
+// NewDeadLetterHandler constructs a DeadLetterHandler.
+func NewDeadLetterHandler(mgr *taskforge.Manager) *DeadLetterHandler {
+	return &DeadLetterHandler{Manager: mgr}
+}
+
+// ListDeadLetters returns dead letter entries, optionally filtered with the
+// handled, task_id and worker_id query parameters and paginated with limit and offset.
+func (h *DeadLetterHandler) ListDeadLetters(c *gin.Context) {
+	ctx := c.Request.Context()
+	filter := map[string]interface{}{}
+	if v := c.Query("handled"); v != "" {
+		handled, err := strconv.ParseBool(v)
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid handled parameter")
+			return
+		}
+		filter["handled"] = handled
+	}
+	if v := c.Query("task_id"); v != "" {
+		taskID, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid task_id parameter")
+			return
+		}
+		filter["task_id"] = taskID
+	}
+	if v := c.Query("worker_id"); v != "" {
+		workerID, err := uuid.Parse(v)
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid worker_id parameter")
+			return
+		}
+		filter["worker_id"] = workerID
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	entries, err := h.Manager.ListDeadLetters(ctx, filter, limit, offset)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// RequeueDeadLetter enqueues a fresh copy of the dead-lettered task and marks
+// the entry handled. An optional body {"payload": "..."} replaces the payload.
+func (h *DeadLetterHandler) RequeueDeadLetter(c *gin.Context) {
+	ctx := c.Request.Context()
+	uuidVal, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid ID parameter")
+		return
+	}
+	var body struct {
+		Payload *string `json:"payload"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.String(http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	t, err := h.Manager.RequeueDeadLetter(ctx, uuidVal, body.Payload)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.String(http.StatusNotFound, "Dead letter not found")
+			return
+		}
+		writeTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, t)
+}
+
+// MarkDeadLetterHandled flags a dead letter entry as handled.
+func (h *DeadLetterHandler) MarkDeadLetterHandled(c *gin.Context) {
+	ctx := c.Request.Context()
+	uuidVal, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid ID parameter")
+		return
+	}
+	if err := h.Manager.MarkDeadLetterHandled(ctx, uuidVal); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.String(http.StatusNotFound, "Dead letter not found")
+			return
+		}
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
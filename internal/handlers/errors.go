@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/taskforge"
+)
+
+// writeTaskError maps task manager errors to HTTP responses: missing tasks are
+// 404; invalid statuses and dependencies, and status changes outside
+// UpdateStatus, 400; and operations that conflict with the task's current
+// state, or with another active task or idempotency key, 409.
+func writeTaskError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.String(http.StatusNotFound, "Task not found")
+	case errors.Is(err, taskforge.ErrInvalidStatus),
+		errors.Is(err, taskforge.ErrStatusChange),
+		errors.Is(err, taskforge.ErrInvalidDependency):
+		c.String(http.StatusBadRequest, err.Error())
+	case errors.Is(err, taskforge.ErrInvalidTransition),
+		errors.Is(err, taskforge.ErrTaskNotPending),
+		errors.Is(err, taskforge.ErrTaskNotInProgress),
+		errors.Is(err, taskforge.ErrTaskNotCancelling),
+		errors.Is(err, taskforge.ErrConcurrentUpdate),
+		errors.Is(err, taskforge.ErrDeadLetterHandled),
+		errors.Is(err, taskforge.ErrAlreadyRetried),
+		errors.Is(err, taskforge.ErrIdempotencyKeyUsed),
+		errors.Is(err, taskforge.ErrTaskConflict):
+		c.String(http.StatusConflict, err.Error())
+	default:
+		c.String(http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/agincgit/taskforge/pkg/taskforge"
+)
+
+// ActorHeader names the request header that identifies who is making a change.
+const ActorHeader = "X-Actor"
+
+// Actor attributes task changes made by a request to the caller named in the
+// ActorHeader, so they show up in the task history.
+func Actor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if actor := c.GetHeader(ActorHeader); actor != "" {
+			c.Request = c.Request.WithContext(taskforge.WithActor(c.Request.Context(), actor))
+		}
+		c.Next()
+	}
+}
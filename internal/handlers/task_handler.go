@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 
 	"github.com/agincgit/taskforge/pkg/model"
 	"github.com/agincgit/taskforge/pkg/taskforge"
@@ -18,20 +21,74 @@ func NewTaskHandler(mgr *taskforge.Manager) *TaskHandler {
 	return &TaskHandler{Manager: mgr}
 }
 
+// IdempotencyKeyHeader names the request header that deduplicates task
+// creation. A repeated key returns the task created by the first request.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// createTaskRequest is the body accepted by CreateTask. RunAt delays the task
+// until the given time.
+type createTaskRequest struct {
+	model.Task
+	RunAt *time.Time `json:"run_at"`
+}
+
 func (h *TaskHandler) CreateTask(c *gin.Context) {
 	ctx := c.Request.Context()
-	var t model.Task
-	if err := c.ShouldBindJSON(&t); err != nil {
+	var req createTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.String(http.StatusBadRequest, "Invalid body")
 		return
 	}
+	t := req.Task
+	if key := c.GetHeader(IdempotencyKeyHeader); key != "" {
+		t.IdempotencyKey = &key
+	}
+	if req.RunAt != nil {
+		runAt := req.RunAt.UTC()
+		t.ScheduledFor = &runAt
+	}
 	if err := h.Manager.CreateTask(ctx, &t); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		writeTaskError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, t)
 }
 
+// CreateTasks enqueues a JSON array of tasks, each shaped like the body of
+// CreateTask, in one transaction. Either every task is created or none is.
+func (h *TaskHandler) CreateTasks(c *gin.Context) {
+	ctx := c.Request.Context()
+	var reqs []createTaskRequest
+	if err := c.ShouldBindJSON(&reqs); err != nil || len(reqs) == 0 {
+		c.String(http.StatusBadRequest, "Invalid body")
+		return
+	}
+	tasks := make([]*model.Task, len(reqs))
+	for i := range reqs {
+		t := reqs[i].Task
+		if reqs[i].RunAt != nil {
+			runAt := reqs[i].RunAt.UTC()
+			t.ScheduledFor = &runAt
+		}
+		tasks[i] = &t
+	}
+	if err := h.Manager.EnqueueBatch(ctx, tasks); err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, tasks)
+}
+
+// taskView is a task as returned by the API, with its derived progress.
+type taskView struct {
+	model.Task
+	taskforge.ProgressEstimate
+}
+
+func newTaskView(t model.Task, now time.Time) taskView {
+	return taskView{Task: t, ProgressEstimate: taskforge.EstimateProgress(&t, now)}
+}
+
 func (h *TaskHandler) GetTasks(c *gin.Context) {
 	ctx := c.Request.Context()
 	tasks, err := h.Manager.GetTasks(ctx)
@@ -39,7 +96,12 @@ func (h *TaskHandler) GetTasks(c *gin.Context) {
 		c.String(http.StatusInternalServerError, err.Error())
 		return
 	}
-	c.JSON(http.StatusOK, tasks)
+	now := time.Now()
+	views := make([]taskView, len(tasks))
+	for i := range tasks {
+		views[i] = newTaskView(tasks[i], now)
+	}
+	c.JSON(http.StatusOK, views)
 }
 
 func (h *TaskHandler) GetTask(c *gin.Context) {
@@ -55,7 +117,7 @@ func (h *TaskHandler) GetTask(c *gin.Context) {
 		c.String(http.StatusNotFound, "Task not found")
 		return
 	}
-	c.JSON(http.StatusOK, t)
+	c.JSON(http.StatusOK, newTaskView(*t, time.Now()))
 }
 
 func (h *TaskHandler) UpdateTask(c *gin.Context) {
@@ -76,7 +138,7 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		return
 	}
 	if err := h.Manager.UpdateTask(ctx, t); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+		writeTaskError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, t)
@@ -96,3 +158,381 @@ func (h *TaskHandler) DeleteTask(c *gin.Context) {
 	}
 	c.Status(http.StatusNoContent)
 }
+
+// SetPriority changes the priority of a pending task.
+func (h *TaskHandler) SetPriority(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	var body struct {
+		Priority *int `json:"priority"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Priority == nil {
+		c.String(http.StatusBadRequest, "Invalid body")
+		return
+	}
+	if err := h.Manager.SetPriority(ctx, uuidVal, *body.Priority); err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// reserveTaskRequest is the optional body accepted by ReserveTask.
+type reserveTaskRequest struct {
+	Types    []string  `json:"types"`
+	Queue    string    `json:"queue"`
+	WorkerID uuid.UUID `json:"worker_id"`
+}
+
+// ReserveTask claims the next pending task matching the requested types or
+// queue. It responds with 204 when no task is available.
+func (h *TaskHandler) ReserveTask(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req reserveTaskRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.String(http.StatusBadRequest, "Invalid body")
+			return
+		}
+	}
+	t, err := h.Manager.ReserveFor(ctx, req.options())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+func (r reserveTaskRequest) options() taskforge.ReserveOptions {
+	return taskforge.ReserveOptions{Types: r.Types, Queue: r.Queue, WorkerID: r.WorkerID}
+}
+
+// reserveTasksRequest is the body accepted by ReserveTasks.
+type reserveTasksRequest struct {
+	reserveTaskRequest
+	Count int `json:"count"`
+}
+
+// ReserveTasks claims up to Count pending tasks matching the requested types or
+// queue in one call. Count may not exceed taskforge.MaxReserveBatch. It
+// responds with an empty list when no task is available. If reservation fails
+// after some tasks were claimed, those tasks are still returned.
+func (h *TaskHandler) ReserveTasks(c *gin.Context) {
+	ctx := c.Request.Context()
+	var req reserveTasksRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Count <= 0 || req.Count > taskforge.MaxReserveBatch {
+		c.String(http.StatusBadRequest, "Invalid body")
+		return
+	}
+	tasks, err := h.Manager.ReserveN(ctx, req.Count, req.options())
+	if err != nil && len(tasks) == 0 {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, tasks)
+}
+
+// ExtendLease pushes the lease of a running task. The body carries the new
+// lease length as a Go duration string, e.g. {"duration": "2m"}. The response
+// reports whether cancellation of the task was requested.
+func (h *TaskHandler) ExtendLease(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	var body struct {
+		Duration string `json:"duration"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.String(http.StatusBadRequest, "Invalid body")
+		return
+	}
+	d, err := time.ParseDuration(body.Duration)
+	if err != nil || d <= 0 {
+		c.String(http.StatusBadRequest, "Invalid duration")
+		return
+	}
+	cancelRequested, err := h.Manager.ExtendLease(ctx, uuidVal, d)
+	if err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cancel_requested": cancelRequested})
+}
+
+// GetTaskHistory returns the status timeline of a task, oldest first.
+func (h *TaskHandler) GetTaskHistory(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	history, err := h.Manager.GetTaskHistory(ctx, uuidVal)
+	if err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// UpdateStatus moves a task to the status given in the body, e.g.
+// {"status": "succeeded"}. Statuses outside the lifecycle are rejected with 400
+// and transitions the lifecycle does not allow with 409.
+func (h *TaskHandler) UpdateStatus(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.String(http.StatusBadRequest, "Invalid body")
+		return
+	}
+	if err := h.Manager.UpdateStatus(ctx, uuidVal, taskforge.Status(body.Status)); err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// FailTask marks an in-progress task as failed with the error in the body, e.g.
+// {"error": "smtp unavailable"}. The task is retried or dead-lettered according
+// to its retry policy.
+func (h *TaskHandler) FailTask(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.String(http.StatusBadRequest, "Invalid body")
+			return
+		}
+	}
+	if err := h.Manager.Fail(ctx, uuidVal, body.Error); err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CompleteTask marks an in-progress task as succeeded. An optional body
+// {"outputs": {"key": "value"}} stores outputs in the same transaction.
+func (h *TaskHandler) CompleteTask(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	var body struct {
+		Outputs map[string]string `json:"outputs"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.String(http.StatusBadRequest, "Invalid body")
+			return
+		}
+	}
+	if err := h.Manager.CompleteWithOutputs(ctx, uuidVal, body.Outputs); err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetOutputs returns the outputs of a task as a JSON object keyed by output name.
+func (h *TaskHandler) GetOutputs(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	outputs, err := h.Manager.GetOutputs(ctx, uuidVal)
+	if err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, outputs)
+}
+
+// WaitingOn lists the dependencies of a task that have not succeeded yet.
+func (h *TaskHandler) WaitingOn(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	deps, err := h.Manager.WaitingOn(ctx, uuidVal)
+	if err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deps)
+}
+
+// SetOutput stores a single named output, e.g. PUT /tasks/:id/outputs/rows with
+// body {"value": "42"}.
+func (h *TaskHandler) SetOutput(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	var body struct {
+		Value *string `json:"value"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Value == nil {
+		c.String(http.StatusBadRequest, "Invalid body")
+		return
+	}
+	if err := h.Manager.SetOutput(ctx, uuidVal, c.Param("key"), *body.Value); err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ReportProgress adds to the item counters of a running task, e.g.
+// {"impacted": 10, "failed": 1}. Set "total" on the first report.
+func (h *TaskHandler) ReportProgress(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	var body struct {
+		Total    int `json:"total"`
+		Impacted int `json:"impacted"`
+		Failed   int `json:"failed"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.String(http.StatusBadRequest, "Invalid body")
+		return
+	}
+	delta := taskforge.Progress{Total: body.Total, Impacted: body.Impacted, Failed: body.Failed}
+	if err := h.Manager.ReportProgress(ctx, uuidVal, delta); err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CancelTask cancels a pending task immediately, or asks the worker running an
+// in-progress task to stop.
+func (h *TaskHandler) CancelTask(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	if err := h.Manager.CancelTask(ctx, uuidVal); err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// AcknowledgeCancel resolves a cancellation request from the worker side with
+// {"cancelled": true} once the work stopped, or false if it could not be stopped.
+func (h *TaskHandler) AcknowledgeCancel(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	var body struct {
+		Cancelled *bool `json:"cancelled"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Cancelled == nil {
+		c.String(http.StatusBadRequest, "Invalid body")
+		return
+	}
+	if err := h.Manager.AcknowledgeCancel(ctx, uuidVal, *body.Cancelled); err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CancelTree cancels a task and its descendants. With {"preserve_completed": true}
+// the subtrees of succeeded tasks are left running.
+func (h *TaskHandler) CancelTree(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	var body struct {
+		PreserveCompleted bool `json:"preserve_completed"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.String(http.StatusBadRequest, "Invalid body")
+			return
+		}
+	}
+	n, err := h.Manager.CancelTree(ctx, uuidVal, taskforge.CancelTreeOptions{PreserveCompleted: body.PreserveCompleted})
+	if err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cancelled": n})
+}
+
+// RetryFailedSubtree retries the failed leaves below a task and returns the new tasks.
+func (h *TaskHandler) RetryFailedSubtree(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	uuidVal, err := uuid.Parse(id)
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	retries, err := h.Manager.RetryFailedSubtree(ctx, uuidVal)
+	if err != nil {
+		writeTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, retries)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/agincgit/taskforge/pkg/taskforge"
+)
+
+// WorkerTypeHandler manages per-task-type settings.
+type WorkerTypeHandler struct {
+	Manager *taskforge.Manager
+}
+
+// NewWorkerTypeHandler constructs a WorkerTypeHandler.
+func NewWorkerTypeHandler(mgr *taskforge.Manager) *WorkerTypeHandler {
+	return &WorkerTypeHandler{Manager: mgr}
+}
+
+// SetRateLimit limits how many tasks of a type may start per period, e.g.
+// PUT /workertypes/partner-call/ratelimit with body {"limit": 10, "period": "1s"}.
+// A limit of 0 removes the limit; the period defaults to one second.
+func (h *WorkerTypeHandler) SetRateLimit(c *gin.Context) {
+	ctx := c.Request.Context()
+	var body struct {
+		Limit  int    `json:"limit"`
+		Period string `json:"period"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Limit < 0 {
+		c.String(http.StatusBadRequest, "Invalid body")
+		return
+	}
+	var period time.Duration
+	if body.Period != "" {
+		d, err := time.ParseDuration(body.Period)
+		if err != nil || d <= 0 {
+			c.String(http.StatusBadRequest, "Invalid period")
+			return
+		}
+		period = d
+	}
+	if err := h.Manager.SetRateLimit(ctx, c.Param("name"), body.Limit, period); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// SetConcurrencyLimit limits how many tasks of a type may run at once, e.g.
+// PUT /workertypes/reindex/concurrency with body {"limit": 3}. A limit of 0
+// removes the limit.
+func (h *WorkerTypeHandler) SetConcurrencyLimit(c *gin.Context) {
+	ctx := c.Request.Context()
+	var body struct {
+		Limit int `json:"limit"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Limit < 0 {
+		c.String(http.StatusBadRequest, "Invalid body")
+		return
+	}
+	if err := h.Manager.SetConcurrencyLimit(ctx, c.Param("name"), body.Limit); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Stats returns per-type queue statistics, including which types are
+// currently throttled by their limits.
+func (h *WorkerTypeHandler) Stats(c *gin.Context) {
+	stats, err := h.Manager.Stats(c.Request.Context())
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
@@ -13,9 +13,11 @@ import (
 func Migrate(db *gorm.DB) error {
 	if err := db.AutoMigrate(
 		&model.Task{},
+		&model.TaskDependency{},
 		&model.TaskInput{},
 		&model.TaskOutput{},
 		&model.TaskHistory{},
+		&model.TaskStart{},
 		&model.TaskTemplate{},
 		&model.WorkerType{},
 		&model.WorkerRegistration{},
@@ -28,6 +28,9 @@ func NewRouter(db *gorm.DB) (*gin.Engine, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := mgr.Start(context.Background()); err != nil {
+		return nil, err
+	}
 
 	sched := scheduler.NewScheduler(mgr)
 	if err := sched.Start(context.Background()); err != nil {
@@ -35,15 +38,45 @@ func NewRouter(db *gorm.DB) (*gin.Engine, error) {
 	}
 
 	router := gin.Default()
+	router.Use(handlers.Actor())
 	api := router.Group("/taskforge/api/v1")
 
 	// Task endpoints
 	th := handlers.NewTaskHandler(mgr)
 	api.POST("/tasks", th.CreateTask)
+	api.POST("/tasks/batch", th.CreateTasks)
 	api.GET("/tasks", th.GetTasks)
+	api.POST("/tasks/reserve", th.ReserveTask)
+	api.POST("/tasks/reserve/batch", th.ReserveTasks)
 	api.GET("/tasks/:id", th.GetTask)
 	api.PUT("/tasks/:id", th.UpdateTask)
 	api.DELETE("/tasks/:id", th.DeleteTask)
+	api.PUT("/tasks/:id/status", th.UpdateStatus)
+	api.PUT("/tasks/:id/priority", th.SetPriority)
+	api.PUT("/tasks/:id/lease", th.ExtendLease)
+	api.POST("/tasks/:id/progress", th.ReportProgress)
+	api.POST("/tasks/:id/complete", th.CompleteTask)
+	api.POST("/tasks/:id/cancel", th.CancelTask)
+	api.POST("/tasks/:id/cancel/ack", th.AcknowledgeCancel)
+	api.POST("/tasks/:id/tree/cancel", th.CancelTree)
+	api.POST("/tasks/:id/tree/retry", th.RetryFailedSubtree)
+	api.POST("/tasks/:id/fail", th.FailTask)
+	api.GET("/tasks/:id/outputs", th.GetOutputs)
+	api.PUT("/tasks/:id/outputs/:key", th.SetOutput)
+	api.GET("/tasks/:id/history", th.GetTaskHistory)
+	api.GET("/tasks/:id/waiting", th.WaitingOn)
+
+	// Dead letter endpoints
+	dlh := handlers.NewDeadLetterHandler(mgr)
+	api.GET("/deadletters", dlh.ListDeadLetters)
+	api.POST("/deadletters/:id/requeue", dlh.RequeueDeadLetter)
+	api.PUT("/deadletters/:id/handled", dlh.MarkDeadLetterHandled)
+
+	// WorkerType endpoints
+	wth := handlers.NewWorkerTypeHandler(mgr)
+	api.PUT("/workertypes/:name/ratelimit", wth.SetRateLimit)
+	api.PUT("/workertypes/:name/concurrency", wth.SetConcurrencyLimit)
+	api.GET("/stats", wth.Stats)
 
 	// WorkerQueue endpoints
 	wqh := handlers.NewWorkerQueueHandler(mgr)
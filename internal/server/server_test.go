@@ -1,14 +1,17 @@
 package server_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
@@ -17,6 +20,19 @@ import (
 	"github.com/agincgit/taskforge/pkg/taskforge"
 )
 
+// reserveSeed starts seed the way a worker would. The database is shared
+// between tests, so only the seed's type is reserved.
+func reserveSeed(t *testing.T, ctx context.Context, mgr *taskforge.Manager, seed *model.Task) {
+	t.Helper()
+	got, err := mgr.ReserveFor(ctx, taskforge.ReserveOptions{Types: []string{seed.Type}})
+	if err != nil {
+		t.Fatalf("failed to reserve task: %v", err)
+	}
+	if got.ID != seed.ID {
+		t.Fatalf("expected to reserve task %s, got %s", seed.ID, got.ID)
+	}
+}
+
 func TestGetTaskByIDRoute(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -56,3 +72,263 @@ func TestGetTaskByIDRoute(t *testing.T) {
 		t.Fatalf("expected task ID %s, got %s", seedTask.ID, got.ID)
 	}
 }
+
+func TestCreateTaskWithRunAt(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	router, err := server.NewRouter(db)
+	if err != nil {
+		t.Fatalf("failed to create router: %v", err)
+	}
+
+	runAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	body, _ := json.Marshal(map[string]interface{}{
+		"Type":   "delayed-task",
+		"run_at": runAt,
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/taskforge/api/v1/tasks", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, resp.Code, resp.Body.String())
+	}
+
+	var got model.Task
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	var stored model.Task
+	if err := db.First(&stored, "id = ?", got.ID).Error; err != nil {
+		t.Fatalf("failed to load stored task: %v", err)
+	}
+	if stored.ScheduledFor == nil || !stored.ScheduledFor.Equal(runAt) {
+		t.Fatalf("expected scheduled time %s, got %v", runAt, stored.ScheduledFor)
+	}
+}
+
+func TestGetTaskHistoryRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	router, err := server.NewRouter(db)
+	if err != nil {
+		t.Fatalf("failed to create router: %v", err)
+	}
+
+	mgr, err := taskforge.NewManager(taskforge.Config{DB: db, Context: context.Background()})
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	seedTask := model.Task{Type: "history-task"}
+	if err := mgr.Enqueue(context.Background(), &seedTask); err != nil {
+		t.Fatalf("failed to seed task: %v", err)
+	}
+
+	reserveSeed(t, taskforge.WithActor(context.Background(), "ops"), mgr, &seedTask)
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/taskforge/api/v1/tasks/%s/history", seedTask.ID), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	var history []model.TaskHistory
+	if err := json.Unmarshal(resp.Body.Bytes(), &history); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("expected 1 history row, got %d", len(history))
+	}
+	if history[0].FromStatus != string(taskforge.StatusPending) || history[0].Status != string(taskforge.StatusInProgress) || history[0].Actor != "ops" {
+		t.Fatalf("unexpected history row: %+v", history[0])
+	}
+}
+
+func TestCompleteTaskWithOutputsRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	router, err := server.NewRouter(db)
+	if err != nil {
+		t.Fatalf("failed to create router: %v", err)
+	}
+
+	mgr, err := taskforge.NewManager(taskforge.Config{DB: db, Context: context.Background()})
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	seedTask := model.Task{Type: "outputs-task"}
+	if err := mgr.Enqueue(context.Background(), &seedTask); err != nil {
+		t.Fatalf("failed to seed task: %v", err)
+	}
+	reserveSeed(t, context.Background(), mgr, &seedTask)
+
+	body := bytes.NewBufferString(`{"outputs": {"rows": "42"}}`)
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/taskforge/api/v1/tasks/%s/complete", seedTask.ID), body)
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusNoContent, resp.Code, resp.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, fmt.Sprintf("/taskforge/api/v1/tasks/%s/outputs", seedTask.ID), nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+	}
+	var outputs map[string]string
+	if err := json.Unmarshal(resp.Body.Bytes(), &outputs); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if outputs["rows"] != "42" {
+		t.Fatalf("unexpected outputs: %v", outputs)
+	}
+}
+
+func TestCreateTaskWithIdempotencyKeyHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	router, err := server.NewRouter(db)
+	if err != nil {
+		t.Fatalf("failed to create router: %v", err)
+	}
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/taskforge/api/v1/tasks", bytes.NewBufferString(`{"Type": "idempotent-task"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "producer-retry-1")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		if resp.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, resp.Code, resp.Body.String())
+		}
+		var got model.Task
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		ids = append(ids, got.ID.String())
+	}
+	if ids[0] != ids[1] {
+		t.Fatalf("expected the repeated request to return the same task, got %s and %s", ids[0], ids[1])
+	}
+}
+
+func TestCreateTaskBatchRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	router, err := server.NewRouter(db)
+	if err != nil {
+		t.Fatalf("failed to create router: %v", err)
+	}
+
+	body := bytes.NewBufferString(`[{"Type": "batch-task", "ReferenceID": "a"}, {"Type": "batch-task", "ReferenceID": "b"}]`)
+	req := httptest.NewRequest(http.MethodPost, "/taskforge/api/v1/tasks/batch", body)
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, resp.Code, resp.Body.String())
+	}
+
+	var got []model.Task
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(got) != 2 || got[0].FriendlyID == 0 || got[0].FriendlyID == got[1].FriendlyID {
+		t.Fatalf("expected two tasks with distinct friendly IDs, got %+v", got)
+	}
+
+	// The database is shared between tests, so only the returned tasks count.
+	var stored int64
+	db.Model(&model.Task{}).Where("id IN ?", []uuid.UUID{got[0].ID, got[1].ID}).Count(&stored)
+	if stored != 2 {
+		t.Fatalf("expected 2 stored tasks, got %d", stored)
+	}
+}
+
+func TestExtendLeaseRouteReportsCancellation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	router, err := server.NewRouter(db)
+	if err != nil {
+		t.Fatalf("failed to create router: %v", err)
+	}
+
+	mgr, err := taskforge.NewManager(taskforge.Config{DB: db, Context: context.Background()})
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	seedTask := model.Task{Type: "lease-task"}
+	if err := mgr.Enqueue(context.Background(), &seedTask); err != nil {
+		t.Fatalf("failed to seed task: %v", err)
+	}
+	reserveSeed(t, context.Background(), mgr, &seedTask)
+
+	extend := func() bool {
+		t.Helper()
+		body := bytes.NewBufferString(`{"duration": "2m"}`)
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/taskforge/api/v1/tasks/%s/lease", seedTask.ID), body)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, resp.Code, resp.Body.String())
+		}
+		var got struct {
+			CancelRequested bool `json:"cancel_requested"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return got.CancelRequested
+	}
+
+	if extend() {
+		t.Fatal("expected no cancellation before one was requested")
+	}
+	if err := mgr.CancelTask(context.Background(), seedTask.ID); err != nil {
+		t.Fatalf("failed to cancel task: %v", err)
+	}
+	if !extend() {
+		t.Fatal("expected the lease extension to report the cancellation")
+	}
+}
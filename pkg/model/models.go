@@ -11,20 +11,46 @@ import (
 // ============================
 type Task struct {
 	BaseModel
-	FriendlyID    uint       `gorm:"autoIncrement;not null"`
-	Type          string     `gorm:"index;not null"`
-	ReferenceID   string     `gorm:"index"`
-	Status        string     `gorm:"index;default:'pending'"`
-	Payload       string     `gorm:"type:text"`
-	Result        string     `gorm:"type:text"`
-	TemplateID    *uuid.UUID `gorm:"type:uuid;index"`
-	ParentTaskID  *uuid.UUID `gorm:"type:uuid"`
-	Attempt       int
-	ScheduledFor  *time.Time `gorm:"index"`
-	StartedAt     *time.Time
-	ItemsTotal    int
-	ItemsImpacted int
-	ItemsFailed   int
+	FriendlyID        uint        `gorm:"autoIncrement;not null"`
+	Type              string      `gorm:"index;not null;uniqueIndex:idx_tasks_type_idempotency_key,priority:1;uniqueIndex:idx_tasks_unique_active,priority:1,where:unique_active AND (status = 'pending' OR status = 'in_progress' OR status = 'pending_cancellation' OR status = 'failed_to_cancel') AND deleted_at IS NULL"`
+	Queue             string      `gorm:"size:255;index"`
+	ReferenceID       string      `gorm:"index;uniqueIndex:idx_tasks_unique_active,priority:2"`
+	IdempotencyKey    *string     `gorm:"size:255;uniqueIndex:idx_tasks_type_idempotency_key,priority:2"`
+	UniqueActive      bool        `gorm:"not null;default:false"` // at most one pending or running task per (Type, ReferenceID)
+	ConflictPolicy    string      `gorm:"-"`                      // how Enqueue resolves a unique conflict: reject, replace or coalesce
+	DependsOn         []uuid.UUID `gorm:"-"`                      // tasks that must succeed before this one runs, set on Enqueue
+	DependencyFailure string      `gorm:"size:20"`                // what happens when a dependency fails: block (default) or fail
+	ChildPolicy       string      `gorm:"size:20"`                // succeed once children finish by: all, any or threshold (empty = don't wait)
+	ChildThreshold    float64     `gorm:"not null;default:0"`     // fraction of children that must succeed under the threshold policy
+	CallbackType      string      `gorm:"size:255"`               // type of the task enqueued when the children resolve the task
+	Status            string      `gorm:"index;default:'pending'"`
+	Priority          int         `gorm:"index;not null;default:0"`
+	Payload           string      `gorm:"type:text"`
+	Result            string      `gorm:"type:text"`
+	LastError         string      `gorm:"type:text"`
+	TemplateID        *uuid.UUID  `gorm:"type:uuid;index"`
+	ParentTaskID      *uuid.UUID  `gorm:"type:uuid"`
+	RetryOfID         *uuid.UUID  `gorm:"type:uuid;index"`
+	Attempt           int
+	ScheduledFor      *time.Time `gorm:"index"`
+	StartedAt         *time.Time
+	LeaseExpiresAt    *time.Time    `gorm:"index"`
+	Timeout           time.Duration // how long a run may take before it is failed (0 = no limit)
+	DeadlineAt        *time.Time    `gorm:"index"` // when the current run times out, set when the task is reserved
+	ExpiresAt         *time.Time    `gorm:"index"` // a pending task that has not started by then expires
+	WorkerID          *uuid.UUID    `gorm:"type:uuid;index"`
+	CancelRequestedAt *time.Time
+	ItemsTotal        int
+	ItemsImpacted     int
+	ItemsFailed       int
+}
+
+// TaskDependency records that the task TaskID may only be reserved once the
+// task DependsOnID has succeeded. Both refer to Task.FriendlyID.
+type TaskDependency struct {
+	BaseModel
+	TaskID      uint `gorm:"not null;uniqueIndex:idx_task_dependencies_edge,priority:1"`
+	DependsOnID uint `gorm:"not null;index;uniqueIndex:idx_task_dependencies_edge,priority:2"`
 }
 
 type TaskInput struct {
@@ -43,9 +69,21 @@ type TaskOutput struct {
 
 type TaskHistory struct {
 	BaseModel
-	TaskID  uint   `gorm:"index;not null"`
-	Status  string `gorm:"not null"`
-	Message string `gorm:"type:text"`
+	TaskID     uint   `gorm:"index;not null"`
+	FromStatus string // empty when the task was created by the transition
+	Status     string `gorm:"not null"`
+	Message    string `gorm:"type:text"`
+	Actor      string `gorm:"size:254"`
+}
+
+// TaskStart records that a task was started. Rate limits count these rows
+// rather than Task.StartedAt, which is cleared when a task is released or
+// reaped and overwritten when it is claimed again.
+type TaskStart struct {
+	BaseModel
+	TaskID    uint      `gorm:"not null"`
+	Type      string    `gorm:"size:255;not null;index:idx_task_starts_type_started_at,priority:1"`
+	StartedAt time.Time `gorm:"not null;index:idx_task_starts_type_started_at,priority:2"`
 }
 
 // ============================
@@ -58,8 +96,12 @@ type TaskTemplate struct {
 	WorkerTypeID   uuid.UUID     `gorm:"type:uuid;not null"`
 	IsRecurring    bool          `gorm:"not null"`
 	CronSchedule   string        `gorm:"size:255"`
-	ExpirationTime time.Duration `gorm:"not null"`
+	ExpirationTime time.Duration `gorm:"not null"` // tasks created from the template expire if not started within this time (0 = never)
+	Timeout        time.Duration // execution timeout of tasks created from the template (0 = no limit)
 	DefaultInputs  string        `gorm:"type:jsonb"`
+	Priority       int           `gorm:"not null;default:0"` // default priority of tasks created from the template
+	MaxAttempts    int           // overrides the worker type and manager retry attempts when non-zero
+	RetryBackoff   time.Duration // overrides the worker type and manager retry backoff when non-zero
 }
 
 // ============================
@@ -67,8 +109,16 @@ type TaskTemplate struct {
 // ============================
 type WorkerType struct {
 	BaseModel
-	Name        string `gorm:"size:255;not null;unique"`
-	Description string `gorm:"type:text"`
+	Name           string        `gorm:"size:255;not null;unique"`
+	Description    string        `gorm:"type:text"`
+	MaxAttempts    int           // overrides the manager retry attempts when non-zero
+	RetryBackoff   time.Duration // overrides the manager retry backoff when non-zero
+	Retention      time.Duration // overrides the manager task retention when non-zero (<0 keeps tasks forever)
+	UniqueActive   bool          // enqueue tasks of this type as unique per ReferenceID
+	ConflictPolicy string        `gorm:"size:20"` // default policy for unique conflicts (empty = reject)
+	RateLimit      int           // tasks of this type that may start per RatePeriod across all workers (0 = unlimited)
+	RatePeriod     time.Duration // window RateLimit applies to (0 = one second)
+	MaxConcurrency int           // tasks of this type that may run at once across all workers (0 = unlimited)
 }
 
 type WorkerRegistration struct {
@@ -100,10 +150,10 @@ type DeadLetterQueue struct {
 
 type TaskCleanup struct {
 	BaseModel
-	WorkerID       uuid.UUID `gorm:"type:uuid;not null;index"`
-	TaskID         uint      `gorm:"index;not null"`
-	ExpirationTime time.Time `gorm:"not null"`
-	DeletedAt      *time.Time
+	WorkerID       uuid.UUID  `gorm:"type:uuid;not null;index"`
+	TaskID         uint       `gorm:"index;not null"`
+	ExpirationTime time.Time  `gorm:"not null"`
+	DeletedAt      *time.Time `gorm:"column:task_deleted_at"` // when the task was removed, not a soft delete of this record
 }
 
 type JobQueue struct {
@@ -0,0 +1,73 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Start launches the Manager's background maintenance loops: reclaiming
+// expired leases, timing out unacknowledged cancellations, failing runs past
+// their timeout, expiring pending tasks past their ExpiresAt and, when
+// Config.CleanupInterval is set, removing terminal tasks past their
+// retention. The loops run until ctx is cancelled; a nil ctx falls back to
+// Config.Context. Calling Start more than once has no effect, and a Manager
+// returned by WithTx cannot be started.
+func (m *Manager) Start(ctx context.Context) error {
+	if m.inTx {
+		return errors.New("taskforge: cannot start a Manager bound to a transaction")
+	}
+	if ctx == nil {
+		ctx = m.ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.started {
+		return nil
+	}
+	m.started = true
+
+	go m.every(ctx, m.reap, "reap expired leases", func(ctx context.Context) error {
+		_, err := m.ReapExpiredLeases(ctx)
+		return err
+	})
+	go m.every(ctx, m.reap, "expire cancellations", func(ctx context.Context) error {
+		_, err := m.ExpireCancellations(ctx)
+		return err
+	})
+	go m.every(ctx, m.reap, "fail timed out tasks", func(ctx context.Context) error {
+		_, err := m.FailTimedOutTasks(ctx)
+		return err
+	})
+	go m.every(ctx, m.reap, "expire pending tasks", func(ctx context.Context) error {
+		_, err := m.ExpirePendingTasks(ctx)
+		return err
+	})
+	if m.cleanup > 0 {
+		go m.every(ctx, m.cleanup, "clean up expired tasks", func(ctx context.Context) error {
+			_, err := m.CleanupExpiredTasks(ctx)
+			return err
+		})
+	}
+	return nil
+}
+
+// every runs fn at the given interval until ctx is cancelled, logging failures.
+func (m *Manager) every(ctx context.Context, interval time.Duration, name string, fn func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := fn(ctx); err != nil && ctx.Err() == nil && m.logger != nil {
+				m.logger.Errorf("taskforge: %s failed: %v", name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package taskforge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// enqueueBatchSize is how many rows EnqueueBatch inserts per statement.
+const enqueueBatchSize = 500
+
+// EnqueueBatch inserts tasks as pending in a single transaction, using
+// multi-row INSERTs of up to enqueueBatchSize tasks each. Either every task is
+// inserted or none is; on success each task has its ID and FriendlyID set.
+// Dependencies must refer to tasks that already exist. As with Enqueue, a
+// task whose idempotency key was used within Config.IdempotencyWindow is
+// replaced by the task that holds the key and not inserted, so a producer may
+// resend a whole batch. Two tasks of the batch sharing a key, or a key taken
+// concurrently, fail the batch with ErrIdempotencyKeyUsed; a unique task with
+// an active duplicate fails it with ErrTaskConflict whatever its conflict
+// policy.
+func (m *Manager) EnqueueBatch(ctx context.Context, tasks []*model.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	db := m.db.WithContext(ctx)
+
+	var types []string
+	seen := make(map[string]bool)
+	for i, t := range tasks {
+		if t == nil || t.Type == "" {
+			return fmt.Errorf("taskforge: batch task %d: task type required", i)
+		}
+		if err := validateChildPolicy(t); err != nil {
+			return fmt.Errorf("taskforge: batch task %d: %w", i, err)
+		}
+		t.Status = string(StatusPending)
+		utcTimes(t)
+		if !seen[t.Type] {
+			seen[t.Type] = true
+			types = append(types, t.Type)
+		}
+	}
+
+	var unique []string
+	if err := db.Model(&model.WorkerType{}).
+		Where("name IN ? AND unique_active = ?", types, true).
+		Pluck("name", &unique).Error; err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		for _, name := range unique {
+			if t.Type == name {
+				t.UniqueActive = true
+			}
+		}
+	}
+
+	if err := batchDuplicates(tasks); err != nil {
+		return err
+	}
+	fresh := make([]*model.Task, 0, len(tasks))
+	for _, t := range tasks {
+		if t.IdempotencyKey != nil {
+			// As in create, this also releases keys held past the window.
+			existing, err := m.findIdempotent(db, t)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				m.reuse(t, existing, fmt.Sprintf("idempotency key %q", *t.IdempotencyKey))
+				continue
+			}
+		}
+		fresh = append(fresh, t)
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+	tasks = fresh
+
+	deps := make(map[int][]model.Task)
+	for i, t := range tasks {
+		resolved, err := m.resolveDependencies(db, t)
+		if err != nil {
+			return fmt.Errorf("taskforge: batch task %d: %w", i, err)
+		}
+		if len(resolved) > 0 {
+			deps[i] = resolved
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(tasks, enqueueBatchSize).Error; err != nil {
+			return err
+		}
+		var edges []model.TaskDependency
+		for i, resolved := range deps {
+			for _, dep := range resolved {
+				edges = append(edges, model.TaskDependency{TaskID: tasks[i].FriendlyID, DependsOnID: dep.FriendlyID})
+			}
+		}
+		if len(edges) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&edges, enqueueBatchSize).Error
+	})
+	if err != nil {
+		// The identifiers assigned before the rollback were never stored.
+		for _, t := range tasks {
+			t.ID = uuid.Nil
+			t.FriendlyID = 0
+		}
+		if cerr := m.batchConflict(db, tasks); cerr != nil {
+			return cerr
+		}
+		return fmt.Errorf("taskforge: batch enqueue failed: %w", err)
+	}
+	if m.logger != nil {
+		m.logger.Infof("Enqueued batch of %d tasks", len(tasks))
+	}
+
+	for i, resolved := range deps {
+		if err := m.checkDependencies(ctx, tasks[i], resolved); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchDuplicates reports tasks in the batch that share a type and either an
+// idempotency key or, for unique tasks, a reference ID.
+func batchDuplicates(tasks []*model.Task) error {
+	keys := make(map[[2]string]int)
+	refs := make(map[[2]string]int)
+	for i, t := range tasks {
+		if t.IdempotencyKey != nil {
+			key := [2]string{t.Type, *t.IdempotencyKey}
+			if j, ok := keys[key]; ok {
+				return fmt.Errorf("%w: batch tasks %d and %d share idempotency key %q", ErrIdempotencyKeyUsed, j, i, *t.IdempotencyKey)
+			}
+			keys[key] = i
+		}
+		if t.UniqueActive {
+			ref := [2]string{t.Type, t.ReferenceID}
+			if j, ok := refs[ref]; ok {
+				return fmt.Errorf("%w: batch tasks %d and %d share reference %q", ErrTaskConflict, j, i, t.ReferenceID)
+			}
+			refs[ref] = i
+		}
+	}
+	return nil
+}
+
+// batchConflict explains a failed batch insert by looking for a task stored
+// concurrently that one of the batch's tasks conflicts with. It only reads, and
+// returns nil if there is none.
+func (m *Manager) batchConflict(db *gorm.DB, tasks []*model.Task) error {
+	for _, t := range tasks {
+		if t.IdempotencyKey != nil {
+			var holders []model.Task
+			if err := db.Unscoped().
+				Where("type = ? AND idempotency_key = ?", t.Type, *t.IdempotencyKey).
+				Limit(1).
+				Find(&holders).Error; err == nil && len(holders) > 0 {
+				return fmt.Errorf("%w: idempotency key %q is held by task %s", ErrIdempotencyKeyUsed, *t.IdempotencyKey, holders[0].ID)
+			}
+		}
+		if t.UniqueActive {
+			if active, err := m.findActive(db, t); err == nil && active != nil {
+				return fmt.Errorf("%w: %s task for reference %q duplicates task %s", ErrTaskConflict, t.Type, t.ReferenceID, active.ID)
+			}
+		}
+	}
+	return nil
+}
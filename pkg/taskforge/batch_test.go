@@ -0,0 +1,146 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestEnqueueBatchAssignsIdentifiers(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+
+	parent := &model.Task{Type: "import"}
+	if err := mgr.Enqueue(ctx, parent); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	// More tasks than fit in one INSERT.
+	tasks := make([]*model.Task, 2*enqueueBatchSize+1)
+	for i := range tasks {
+		tasks[i] = &model.Task{Type: "import-row", ReferenceID: fmt.Sprintf("row-%d", i)}
+	}
+	tasks[0].DependsOn = []uuid.UUID{parent.ID}
+	if err := mgr.EnqueueBatch(ctx, tasks); err != nil {
+		t.Fatalf("batch enqueue failed: %v", err)
+	}
+
+	seen := make(map[uint]bool)
+	for i, task := range tasks {
+		if task.ID == uuid.Nil || task.FriendlyID == 0 || seen[task.FriendlyID] {
+			t.Fatalf("task %d has no distinct identifiers: %s / %d", i, task.ID, task.FriendlyID)
+		}
+		seen[task.FriendlyID] = true
+		if task.Status != string(StatusPending) {
+			t.Fatalf("expected task %d to be pending, got %s", i, task.Status)
+		}
+	}
+
+	var stored int64
+	db.Model(&model.Task{}).Where("type = ?", "import-row").Count(&stored)
+	if stored != int64(len(tasks)) {
+		t.Fatalf("expected %d stored tasks, got %d", len(tasks), stored)
+	}
+	last, err := mgr.GetTask(ctx, tasks[len(tasks)-1].ID)
+	if err != nil || last.FriendlyID != tasks[len(tasks)-1].FriendlyID {
+		t.Fatalf("expected the last task to be stored under its identifiers, got %v (%v)", last, err)
+	}
+	waiting, err := mgr.WaitingOn(ctx, tasks[0].ID)
+	if err != nil || len(waiting) != 1 || waiting[0].ID != parent.ID {
+		t.Fatalf("expected the first task to wait on its dependency, got %v (%v)", waiting, err)
+	}
+}
+
+func TestEnqueueBatchIsAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+
+	active := &model.Task{Type: "sync", ReferenceID: "acct-1", UniqueActive: true}
+	if err := mgr.Enqueue(ctx, active); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	conflicting := []*model.Task{
+		{Type: "sync", ReferenceID: "acct-2", UniqueActive: true},
+		{Type: "sync", ReferenceID: "acct-1", UniqueActive: true, ConflictPolicy: string(ConflictCoalesce)},
+	}
+	if err := mgr.EnqueueBatch(ctx, conflicting); !errors.Is(err, ErrTaskConflict) {
+		t.Fatalf("expected ErrTaskConflict, got %v", err)
+	}
+	if conflicting[0].ID != uuid.Nil || conflicting[0].FriendlyID != 0 {
+		t.Fatalf("expected identifiers of the rolled back batch to be cleared, got %s / %d", conflicting[0].ID, conflicting[0].FriendlyID)
+	}
+
+	duplicated := []*model.Task{
+		{Type: "sync", ReferenceID: "acct-3", UniqueActive: true},
+		{Type: "sync", ReferenceID: "acct-3", UniqueActive: true},
+	}
+	if err := mgr.EnqueueBatch(ctx, duplicated); !errors.Is(err, ErrTaskConflict) {
+		t.Fatalf("expected ErrTaskConflict for duplicates within the batch, got %v", err)
+	}
+
+	missing := []*model.Task{
+		{Type: "sync", ReferenceID: "acct-4"},
+		{Type: "sync", ReferenceID: "acct-5", DependsOn: []uuid.UUID{uuid.New()}},
+	}
+	if err := mgr.EnqueueBatch(ctx, missing); !errors.Is(err, ErrInvalidDependency) {
+		t.Fatalf("expected ErrInvalidDependency, got %v", err)
+	}
+
+	var stored int64
+	db.Model(&model.Task{}).Count(&stored)
+	if stored != 1 {
+		t.Fatalf("expected only the original task to be stored, got %d tasks", stored)
+	}
+}
+
+func TestEnqueueBatchHonoursIdempotencyWindow(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{IdempotencyWindow: time.Hour})
+
+	key := "import-42"
+	first := &model.Task{Type: "import-row", IdempotencyKey: &key}
+	if err := mgr.Enqueue(ctx, first); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	// Resending a key within the window returns the task that holds it.
+	batch := []*model.Task{{Type: "import-row", IdempotencyKey: &key}, {Type: "import-row"}}
+	if err := mgr.EnqueueBatch(ctx, batch); err != nil {
+		t.Fatalf("batch enqueue within the window failed: %v", err)
+	}
+	if batch[0].ID != first.ID {
+		t.Fatalf("expected the existing task for a repeated key, got %s", batch[0].ID)
+	}
+	if batch[1].ID == uuid.Nil || batch[1].ID == first.ID {
+		t.Fatalf("expected the task without a key to be inserted, got %s", batch[1].ID)
+	}
+	var stored int64
+	if err := db.Model(&model.Task{}).Count(&stored).Error; err != nil || stored != 2 {
+		t.Fatalf("expected 2 stored tasks, got %d (%v)", stored, err)
+	}
+
+	other := "import-43"
+	shared := []*model.Task{{Type: "import-row", IdempotencyKey: &other}, {Type: "import-row", IdempotencyKey: &other}}
+	if err := mgr.EnqueueBatch(ctx, shared); !errors.Is(err, ErrIdempotencyKeyUsed) {
+		t.Fatalf("expected ErrIdempotencyKeyUsed for a key shared within the batch, got %v", err)
+	}
+
+	// Once the window has passed the key is released.
+	if err := db.Model(first).UpdateColumn("created_at", db.NowFunc().Add(-2*time.Hour)).Error; err != nil {
+		t.Fatalf("failed to age task: %v", err)
+	}
+	batch = []*model.Task{{Type: "import-row", IdempotencyKey: &key}}
+	if err := mgr.EnqueueBatch(ctx, batch); err != nil {
+		t.Fatalf("batch enqueue after window failed: %v", err)
+	}
+	if batch[0].ID == first.ID || batch[0].FriendlyID == 0 {
+		t.Fatalf("expected a new task to take over the key, got %s", batch[0].ID)
+	}
+}
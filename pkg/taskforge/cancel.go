@@ -0,0 +1,128 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// CancelTask cancels a task. A pending task is cancelled immediately. An
+// in-progress task moves to pending_cancellation: its worker learns about the
+// request from ExtendLease and resolves it with AcknowledgeCancel, or the task
+// becomes failed_to_cancel once Config.CancelTimeout passes. Tasks in any other
+// status are left unchanged.
+func (m *Manager) CancelTask(ctx context.Context, id uuid.UUID) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var t model.Task
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status IN ?", id, []string{string(StatusPending), string(StatusInProgress)}).
+			Take(&t).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ok, err := m.requestCancel(ctx, tx, &t)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrConcurrentUpdate
+		}
+		return nil
+	})
+}
+
+// requestCancel applies CancelTask to t inside tx and reports whether its status
+// changed. Tasks that are neither pending nor in progress are left alone.
+func (m *Manager) requestCancel(ctx context.Context, tx *gorm.DB, t *model.Task) (bool, error) {
+	switch Status(t.Status) {
+	case StatusPending:
+		ok, err := m.setStatus(ctx, tx, t, StatusCancelled, "", nil)
+		if !ok || err != nil {
+			return ok, err
+		}
+		return true, m.finished(ctx, tx, t)
+	case StatusInProgress:
+		return m.setStatus(ctx, tx, t, StatusPendingCancel, "", map[string]interface{}{
+			"cancel_requested_at": time.Now().UTC(),
+		})
+	}
+	return false, nil
+}
+
+// AcknowledgeCancel resolves a cancellation request for a running task. The
+// worker passes cancelled=true once it has stopped the work, or false if the
+// work could not be stopped, which moves the task to failed_to_cancel so the
+// worker can still complete it. It returns ErrTaskNotCancelling when no
+// cancellation is pending.
+func (m *Manager) AcknowledgeCancel(ctx context.Context, id uuid.UUID, cancelled bool) error {
+	to := StatusFailedToCancel
+	if cancelled {
+		to = StatusCancelled
+	}
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var t model.Task
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&t, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if Status(t.Status) != StatusPendingCancel {
+			return ErrTaskNotCancelling
+		}
+		ok, err := m.setStatus(ctx, tx, &t, to, "", nil)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrConcurrentUpdate
+		}
+		if cancelled {
+			return m.finished(ctx, tx, &t)
+		}
+		return nil
+	})
+}
+
+// ExpireCancellations moves tasks whose cancellation has not been acknowledged
+// within Config.CancelTimeout to failed_to_cancel. It returns the number of
+// tasks moved.
+func (m *Manager) ExpireCancellations(ctx context.Context) (int, error) {
+	cutoff := time.Now().UTC().Add(-m.cancel)
+	var stale []model.Task
+	if err := m.db.WithContext(ctx).
+		Where("status = ? AND cancel_requested_at < ?", string(StatusPendingCancel), cutoff).
+		Find(&stale).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for i := range stale {
+		var ok bool
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var err error
+			ok, err = m.setStatus(ctx, tx, &stale[i], StatusFailedToCancel, cancelTimeoutMessage, nil)
+			return err
+		})
+		if err != nil {
+			return expired, err
+		}
+		if ok {
+			if m.logger != nil {
+				m.logger.Errorf("Cancellation of task ID=%s was not acknowledged in time", stale[i].ID)
+			}
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// cancelTimeoutMessage is the history message recorded when a cancellation expires.
+const cancelTimeoutMessage = "cancellation timed out"
@@ -0,0 +1,111 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestCancelTask(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	pending := &model.Task{Type: "cancel-me"}
+	running := &model.Task{Type: "cancel-me"}
+	startTask(t, mgr, running)
+	if err := mgr.Enqueue(ctx, pending); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	if err := mgr.CancelTask(ctx, pending.ID); err != nil {
+		t.Fatalf("cancel pending failed: %v", err)
+	}
+	if got, _ := mgr.GetTask(ctx, pending.ID); got.Status != string(StatusCancelled) {
+		t.Fatalf("expected pending task to be cancelled immediately, got %s", got.Status)
+	}
+
+	if err := mgr.CancelTask(ctx, running.ID); err != nil {
+		t.Fatalf("cancel running failed: %v", err)
+	}
+	got, _ := mgr.GetTask(ctx, running.ID)
+	if got.Status != string(StatusPendingCancel) || got.CancelRequestedAt == nil {
+		t.Fatalf("expected running task to await cancellation, got %s (%v)", got.Status, got.CancelRequestedAt)
+	}
+	if cancelRequested, err := mgr.ExtendLease(ctx, running.ID, time.Minute); err != nil || !cancelRequested {
+		t.Fatalf("expected ExtendLease to signal cancellation, got %v (%v)", cancelRequested, err)
+	}
+	if err := mgr.AcknowledgeCancel(ctx, running.ID, true); err != nil {
+		t.Fatalf("acknowledge failed: %v", err)
+	}
+	if got, _ := mgr.GetTask(ctx, running.ID); got.Status != string(StatusCancelled) {
+		t.Fatalf("expected task to be cancelled, got %s", got.Status)
+	}
+	if err := mgr.AcknowledgeCancel(ctx, running.ID, true); !errors.Is(err, ErrTaskNotCancelling) {
+		t.Fatalf("expected ErrTaskNotCancelling, got %v", err)
+	}
+}
+
+func TestFailDuringCancellationCancelsTask(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{Retry: RetryPolicy{Attempts: 3}})
+
+	task := &model.Task{Type: "cancel-me"}
+	if err := mgr.Enqueue(ctx, task); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if _, err := mgr.Reserve(ctx); err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if err := mgr.CancelTask(ctx, task.ID); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	if err := mgr.Fail(ctx, task.ID, "stopped"); err != nil {
+		t.Fatalf("fail failed: %v", err)
+	}
+
+	if got, _ := mgr.GetTask(ctx, task.ID); got.Status != string(StatusCancelled) {
+		t.Fatalf("expected the task to be cancelled, got %s", got.Status)
+	}
+	var retries, deadLetters int64
+	if err := db.Model(&model.Task{}).Where("retry_of_id = ?", task.ID).Count(&retries).Error; err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if err := db.Model(&model.DeadLetterQueue{}).Count(&deadLetters).Error; err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if retries != 0 || deadLetters != 0 {
+		t.Fatalf("expected no retry or dead letter, got %d retries and %d dead letters", retries, deadLetters)
+	}
+}
+
+func TestExpireCancellations(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{CancelTimeout: time.Minute})
+
+	stale := time.Now().UTC().Add(-time.Hour)
+	recent := time.Now().UTC()
+	expired := model.Task{Type: "stuck", Status: string(StatusPendingCancel), CancelRequestedAt: &stale}
+	waiting := model.Task{Type: "stuck", Status: string(StatusPendingCancel), CancelRequestedAt: &recent}
+	for _, task := range []*model.Task{&expired, &waiting} {
+		if err := db.Create(task).Error; err != nil {
+			t.Fatalf("failed to seed task: %v", err)
+		}
+	}
+
+	n, err := mgr.ExpireCancellations(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 expired cancellation, got %d (%v)", n, err)
+	}
+	if got, _ := mgr.GetTask(ctx, expired.ID); got.Status != string(StatusFailedToCancel) {
+		t.Fatalf("expected failed_to_cancel, got %s", got.Status)
+	}
+	if got, _ := mgr.GetTask(ctx, waiting.ID); got.Status != string(StatusPendingCancel) {
+		t.Fatalf("expected recent request to keep waiting, got %s", got.Status)
+	}
+	if err := mgr.Complete(ctx, expired.ID, true); err != nil {
+		t.Fatalf("expected the worker to still complete the task: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package taskforge
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// cleanupBatchSize caps how many tasks are removed per transaction.
+const cleanupBatchSize = 500
+
+// CleanupExpiredTasks removes terminal tasks that have not changed for longer
+// than their retention period, together with their inputs, outputs, history
+// and dependencies, and records each removal in TaskCleanup. Retention comes
+// from the task's worker type when set, otherwise from Config.Retention. Tasks
+// are soft-deleted unless Config.PurgeOnCleanup is set. Tasks with unfinished
+// children or dependents, or with unhandled dead letter entries, are kept. It
+// returns the number of tasks removed.
+func (m *Manager) CleanupExpiredTasks(ctx context.Context) (int, error) {
+	var types []model.WorkerType
+	if err := m.db.WithContext(ctx).Where("retention <> 0").Find(&types).Error; err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	overridden := make([]string, 0, len(types))
+	for _, wt := range types {
+		overridden = append(overridden, wt.Name)
+		if wt.Retention < 0 {
+			continue
+		}
+		n, err := m.cleanupTasks(ctx, wt.Retention, func(db *gorm.DB) *gorm.DB {
+			return db.Where("type = ?", wt.Name)
+		})
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	if m.keep < 0 {
+		return removed, nil
+	}
+	n, err := m.cleanupTasks(ctx, m.keep, func(db *gorm.DB) *gorm.DB {
+		if len(overridden) == 0 {
+			return db
+		}
+		return db.Where("type NOT IN ?", overridden)
+	})
+	return removed + n, err
+}
+
+// cleanupTasks removes the expired tasks selected by scope in batches.
+func (m *Manager) cleanupTasks(ctx context.Context, retention time.Duration, scope func(*gorm.DB) *gorm.DB) (int, error) {
+	removed := 0
+	for {
+		n, err := m.cleanupBatch(ctx, retention, scope)
+		removed += n
+		if err != nil || n < cleanupBatchSize {
+			return removed, err
+		}
+	}
+}
+
+func (m *Manager) cleanupBatch(ctx context.Context, retention time.Duration, scope func(*gorm.DB) *gorm.DB) (int, error) {
+	var removed int
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		terminal := terminalStatuses()
+		var tasks []model.Task
+		if err := scope(tx.Model(&model.Task{})).
+			Where("status IN ? AND updated_at < ?", terminal, m.dbNow().Add(-retention)).
+			Where("NOT EXISTS (SELECT 1 FROM tasks AS c WHERE c.parent_task_id = tasks.id AND c.deleted_at IS NULL AND c.status NOT IN ?)", terminal).
+			Where("NOT EXISTS (SELECT 1 FROM task_dependencies AS e JOIN tasks AS w ON w.friendly_id = e.task_id WHERE e.depends_on_id = tasks.friendly_id AND e.deleted_at IS NULL AND w.deleted_at IS NULL AND w.status NOT IN ?)", terminal).
+			Where("NOT EXISTS (SELECT 1 FROM dead_letter_queues AS d WHERE d.task_id = tasks.friendly_id AND d.deleted_at IS NULL AND d.handled = ?)", false).
+			Order("updated_at").
+			Limit(cleanupBatchSize).
+			Find(&tasks).Error; err != nil {
+			return err
+		}
+		if len(tasks) == 0 {
+			return nil
+		}
+
+		deletedAt := time.Now().UTC()
+		ids := make([]uuid.UUID, len(tasks))
+		friendlyIDs := make([]uint, len(tasks))
+		records := make([]model.TaskCleanup, len(tasks))
+		for i, t := range tasks {
+			ids[i] = t.ID
+			friendlyIDs[i] = t.FriendlyID
+			records[i] = model.TaskCleanup{
+				TaskID:         t.FriendlyID,
+				ExpirationTime: t.UpdatedAt.Add(retention).UTC(),
+				DeletedAt:      &deletedAt,
+			}
+			if t.WorkerID != nil {
+				records[i].WorkerID = *t.WorkerID
+			}
+		}
+
+		del := tx
+		if m.cfg.PurgeOnCleanup {
+			del = tx.Unscoped().Session(&gorm.Session{})
+		}
+		for _, related := range []interface{}{&model.TaskInput{}, &model.TaskOutput{}, &model.TaskHistory{}, &model.TaskDependency{}} {
+			if err := del.Where("task_id IN ?", friendlyIDs).Delete(related).Error; err != nil {
+				return err
+			}
+		}
+		if err := del.Where("id IN ?", ids).Delete(&model.Task{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&records).Error; err != nil {
+			return err
+		}
+		removed = len(tasks)
+		return nil
+	})
+	if err == nil && removed > 0 && m.logger != nil {
+		m.logger.Infof("Cleaned up %d expired tasks", removed)
+	}
+	return removed, err
+}
@@ -0,0 +1,113 @@
+package taskforge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestCleanupExpiredTasks(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{Retention: time.Hour})
+
+	if err := db.Create(&model.WorkerType{Name: "audit", Retention: -1}).Error; err != nil {
+		t.Fatalf("failed to seed worker type: %v", err)
+	}
+	if err := db.Create(&model.WorkerType{Name: "report", Retention: 48 * time.Hour}).Error; err != nil {
+		t.Fatalf("failed to seed worker type: %v", err)
+	}
+
+	old := db.NowFunc().Add(-2 * time.Hour)
+	expired := model.Task{Type: "email", Status: string(StatusSucceeded)}
+	fresh := model.Task{Type: "email", Status: string(StatusSucceeded)}
+	active := model.Task{Type: "email", Status: string(StatusPending)}
+	kept := model.Task{Type: "audit", Status: string(StatusFailed)}
+	report := model.Task{Type: "report", Status: string(StatusCancelled)}
+	parent := model.Task{Type: "email", Status: string(StatusFailed)}
+	seeded := []*model.Task{&expired, &fresh, &active, &kept, &report, &parent}
+	for _, task := range seeded {
+		if err := db.Create(task).Error; err != nil {
+			t.Fatalf("failed to seed task: %v", err)
+		}
+	}
+	child := model.Task{Type: "email", Status: string(StatusPending), ParentTaskID: &parent.ID}
+	if err := db.Create(&child).Error; err != nil {
+		t.Fatalf("failed to seed child: %v", err)
+	}
+	for _, task := range []*model.Task{&expired, &active, &kept, &report, &parent} {
+		if err := db.Model(task).UpdateColumn("updated_at", old).Error; err != nil {
+			t.Fatalf("failed to age task: %v", err)
+		}
+	}
+	related := []interface{}{
+		&model.TaskInput{TaskID: expired.FriendlyID, InputKey: "k", InputValue: "v"},
+		&model.TaskOutput{TaskID: expired.FriendlyID, OutputKey: "k", Value: "v"},
+		&model.TaskHistory{TaskID: expired.FriendlyID, Status: string(StatusSucceeded)},
+	}
+	for _, row := range related {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("failed to seed related row: %v", err)
+		}
+	}
+
+	removed, err := mgr.CleanupExpiredTasks(ctx)
+	if err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("expected 1 task removed, got %d", removed)
+	}
+	if _, err := mgr.GetTask(ctx, expired.ID); err == nil {
+		t.Fatalf("expected expired task to be removed")
+	}
+	for _, task := range []*model.Task{&fresh, &active, &kept, &report, &parent} {
+		if _, err := mgr.GetTask(ctx, task.ID); err != nil {
+			t.Fatalf("expected task %s (%s) to be kept: %v", task.Type, task.Status, err)
+		}
+	}
+
+	var soft int64
+	db.Unscoped().Model(&model.Task{}).Where("id = ? AND deleted_at IS NOT NULL", expired.ID).Count(&soft)
+	if soft != 1 {
+		t.Fatalf("expected the task to be soft-deleted")
+	}
+	for _, row := range []interface{}{&model.TaskInput{}, &model.TaskOutput{}, &model.TaskHistory{}} {
+		var n int64
+		db.Model(row).Where("task_id = ?", expired.FriendlyID).Count(&n)
+		if n != 0 {
+			t.Fatalf("expected %T rows to be removed, %d left", row, n)
+		}
+	}
+
+	var records []model.TaskCleanup
+	if err := db.Find(&records).Error; err != nil || len(records) != 1 {
+		t.Fatalf("expected one cleanup record, got %d (%v)", len(records), err)
+	}
+	if records[0].TaskID != expired.FriendlyID || records[0].DeletedAt == nil {
+		t.Fatalf("unexpected cleanup record: %+v", records[0])
+	}
+}
+
+func TestCleanupExpiredTasksPurges(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{Retention: time.Minute, PurgeOnCleanup: true})
+
+	task := model.Task{Type: "email", Status: string(StatusSucceeded)}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("failed to seed task: %v", err)
+	}
+	if err := db.Model(&task).UpdateColumn("updated_at", db.NowFunc().Add(-time.Hour)).Error; err != nil {
+		t.Fatalf("failed to age task: %v", err)
+	}
+
+	if removed, err := mgr.CleanupExpiredTasks(ctx); err != nil || removed != 1 {
+		t.Fatalf("expected 1 task removed, got %d (%v)", removed, err)
+	}
+	var n int64
+	db.Unscoped().Model(&model.Task{}).Where("id = ?", task.ID).Count(&n)
+	if n != 0 {
+		t.Fatalf("expected the task row to be purged")
+	}
+}
@@ -9,16 +9,49 @@ import (
 
 // RetryPolicy controls how and when retries happen.
 type RetryPolicy struct {
-	Attempts int           // total number of tries
-	Backoff  time.Duration // delay between retries
+	Attempts   int           // total number of tries
+	Backoff    time.Duration // delay before the first retry, doubled for each further retry
+	MaxBackoff time.Duration // upper bound on the retry delay (0 = unbounded)
+	Jitter     float64       // random fraction of the delay added on top (0 = DefaultRetryJitter)
 }
 
+// DefaultRetryJitter is the jitter fraction used when RetryPolicy.Jitter is unset.
+const DefaultRetryJitter = 0.1
+
+// DefaultPriorityAging is the priority aging threshold used when Config.PriorityAging is unset.
+const DefaultPriorityAging = 10 * time.Minute
+
+// DefaultLeaseDuration is how long a reservation is held when neither
+// Config.LeaseDuration nor ReserveOptions.Lease is set.
+const DefaultLeaseDuration = 5 * time.Minute
+
+// DefaultReapInterval is how often expired leases are reclaimed when Config.ReapInterval is unset.
+const DefaultReapInterval = 30 * time.Second
+
+// DefaultCancelTimeout is how long a running task may take to acknowledge a
+// cancellation request when Config.CancelTimeout is unset.
+const DefaultCancelTimeout = 10 * time.Minute
+
+// DefaultIdempotencyWindow is how long an idempotency key deduplicates enqueues
+// when Config.IdempotencyWindow is unset.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// DefaultRetention is how long terminal tasks are kept when Config.Retention is unset.
+const DefaultRetention = 7 * 24 * time.Hour
+
 // Config configures the Manager programmatically.
 type Config struct {
-	DB              *gorm.DB        // your GORM DB handle
-	TableName       string          // e.g. "tasks"
-	Retry           RetryPolicy     // retry/backoff settings
-	CleanupInterval time.Duration   // how often to purge old tasks
-	Logger          Logger          // optional logger (may be nil)
-	Context         context.Context // root context for operations
+	DB                *gorm.DB        // your GORM DB handle
+	TableName         string          // e.g. "tasks"
+	Retry             RetryPolicy     // retry/backoff settings
+	CleanupInterval   time.Duration   // how often to purge old tasks (0 = never)
+	Retention         time.Duration   // how long terminal tasks are kept (0 = default, <0 keeps them forever)
+	PurgeOnCleanup    bool            // hard-delete expired tasks instead of soft-deleting them
+	PriorityAging     time.Duration   // serve tasks waiting longer than this first (0 = default, <0 disables)
+	LeaseDuration     time.Duration   // how long a reserved task may run without extending its lease
+	ReapInterval      time.Duration   // how often expired leases, cancellations, timeouts and pending expiries are swept
+	CancelTimeout     time.Duration   // how long a running task may take to acknowledge cancellation
+	IdempotencyWindow time.Duration   // how long an idempotency key returns the task it created
+	Logger            Logger          // optional logger (may be nil)
+	Context           context.Context // root context for operations
 }
@@ -0,0 +1,120 @@
+package taskforge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// deadLetter records a task that failed with no attempts left in the dead
+// letter queue, then runs the follow-ups of its final failure.
+func (m *Manager) deadLetter(ctx context.Context, db *gorm.DB, t *model.Task, errMsg string) error {
+	entry := model.DeadLetterQueue{
+		TaskID:       t.FriendlyID,
+		FailedAt:     time.Now().UTC(),
+		ErrorMessage: errMsg,
+		RetryCount:   t.Attempt,
+	}
+	if t.WorkerID != nil {
+		entry.WorkerID = *t.WorkerID
+	}
+	if m.logger != nil {
+		m.logger.Errorf("Task ID=%s failed after %d attempts, moving it to the dead letter queue", t.ID, t.Attempt+1)
+	}
+	if err := db.WithContext(ctx).Create(&entry).Error; err != nil {
+		return err
+	}
+	return m.finished(ctx, db, t)
+}
+
+// ListDeadLetters returns dead letter entries filtered by optional fields
+// (task_id, worker_id, handled) with pagination, oldest first.
+func (m *Manager) ListDeadLetters(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]model.DeadLetterQueue, error) {
+	var entries []model.DeadLetterQueue
+	db := m.db.WithContext(ctx)
+	if v, ok := filter["task_id"]; ok {
+		db = db.Where("task_id = ?", v)
+	}
+	if v, ok := filter["worker_id"]; ok {
+		db = db.Where("worker_id = ?", v)
+	}
+	if v, ok := filter["handled"]; ok {
+		db = db.Where("handled = ?", v)
+	}
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	if offset > 0 {
+		db = db.Offset(offset)
+	}
+	if err := db.Order("failed_at, id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// RequeueDeadLetter enqueues a fresh copy of a dead-lettered task, starting
+// again from its first attempt, and marks the entry handled. A non-nil payload
+// replaces the original task's payload. It returns ErrDeadLetterHandled if the
+// entry was already handled, and ErrAlreadyRetried if the task was retried
+// some other way.
+func (m *Manager) RequeueDeadLetter(ctx context.Context, id uuid.UUID, payload *string) (*model.Task, error) {
+	var requeued model.Task
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var entry model.DeadLetterQueue
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&entry, "id = ?", id).Error; err != nil {
+			return err
+		}
+		res := tx.Model(&model.DeadLetterQueue{}).
+			Where("id = ? AND handled = ?", id, false).
+			Update("handled", true)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrDeadLetterHandled
+		}
+
+		var failed model.Task
+		if err := tx.Unscoped().Where("friendly_id = ?", entry.TaskID).Take(&failed).Error; err != nil {
+			return err
+		}
+		requeued = newRetryTask(failed)
+		requeued.Attempt = 0
+		if payload != nil {
+			requeued.Payload = *payload
+		}
+		if m.logger != nil {
+			m.logger.Infof("Requeueing task ID=%s from the dead letter queue", failed.ID)
+		}
+		if err := m.scheduleRetry(ctx, tx, &failed, &requeued, fmt.Sprintf("requeued from dead letter %s", entry.ID)); err != nil {
+			return fmt.Errorf("taskforge: failed to requeue dead letter: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &requeued, nil
+}
+
+// MarkDeadLetterHandled flags a dead letter entry as handled without requeueing it.
+func (m *Manager) MarkDeadLetterHandled(ctx context.Context, id uuid.UUID) error {
+	res := m.db.WithContext(ctx).
+		Model(&model.DeadLetterQueue{}).
+		Where("id = ?", id).
+		Update("handled", true)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestFinalFailureIsDeadLettered(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{Retry: RetryPolicy{Attempts: 2}})
+	workerID := uuid.New()
+
+	task := &model.Task{Type: "flaky", Payload: `{"v":1}`}
+	if err := mgr.Enqueue(ctx, task); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if _, err := mgr.ReserveFor(ctx, ReserveOptions{WorkerID: workerID}); err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if err := mgr.Fail(ctx, task.ID, "first"); err != nil {
+		t.Fatalf("fail failed: %v", err)
+	}
+	if entries, err := mgr.ListDeadLetters(ctx, nil, 0, 0); err != nil || len(entries) != 0 {
+		t.Fatalf("expected no dead letters while retries remain, got %d (%v)", len(entries), err)
+	}
+
+	var retry model.Task
+	if err := db.Where("retry_of_id = ?", task.ID).Take(&retry).Error; err != nil {
+		t.Fatalf("expected a retry task: %v", err)
+	}
+	if retry.LastError != "" || retry.WorkerID != nil {
+		t.Fatalf("expected the retry to start clean, got error %q worker %v", retry.LastError, retry.WorkerID)
+	}
+	if err := db.Model(&retry).Updates(map[string]interface{}{"status": string(StatusInProgress), "worker_id": workerID}).Error; err != nil {
+		t.Fatalf("failed to start retry: %v", err)
+	}
+	if err := mgr.Fail(ctx, retry.ID, "second"); err != nil {
+		t.Fatalf("fail failed: %v", err)
+	}
+
+	entries, err := mgr.ListDeadLetters(ctx, map[string]interface{}{"handled": false}, 0, 0)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one dead letter, got %d (%v)", len(entries), err)
+	}
+	entry := entries[0]
+	if entry.TaskID != retry.FriendlyID || entry.WorkerID != workerID || entry.ErrorMessage != "second" || entry.RetryCount != 1 {
+		t.Fatalf("unexpected dead letter entry: %+v", entry)
+	}
+	failed, err := mgr.GetTask(ctx, retry.ID)
+	if err != nil || failed.LastError != "second" {
+		t.Fatalf("expected LastError to be stored, got %+v (%v)", failed, err)
+	}
+
+	payload := `{"v":2}`
+	requeued, err := mgr.RequeueDeadLetter(ctx, entry.ID, &payload)
+	if err != nil {
+		t.Fatalf("requeue failed: %v", err)
+	}
+	if requeued.Status != string(StatusPending) || requeued.Attempt != 0 || requeued.Payload != payload {
+		t.Fatalf("unexpected requeued task: %+v", requeued)
+	}
+	if requeued.RetryOfID == nil || *requeued.RetryOfID != retry.ID {
+		t.Fatalf("expected requeued task to link to the failed task")
+	}
+	if _, err := mgr.RequeueDeadLetter(ctx, entry.ID, nil); !errors.Is(err, ErrDeadLetterHandled) {
+		t.Fatalf("expected ErrDeadLetterHandled, got %v", err)
+	}
+	if entries, _ := mgr.ListDeadLetters(ctx, map[string]interface{}{"handled": false}, 0, 0); len(entries) != 0 {
+		t.Fatalf("expected the entry to be handled, got %d unhandled", len(entries))
+	}
+}
+
+func TestRequeuedTaskIsNotRetriedAgain(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	task := &model.Task{Type: "pipeline"}
+	if err := mgr.Enqueue(ctx, task); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if _, err := mgr.Reserve(ctx); err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if err := mgr.Fail(ctx, task.ID, "boom"); err != nil {
+		t.Fatalf("fail failed: %v", err)
+	}
+	entries, err := mgr.ListDeadLetters(ctx, nil, 0, 0)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one dead letter, got %d (%v)", len(entries), err)
+	}
+	if _, err := mgr.RequeueDeadLetter(ctx, entries[0].ID, nil); err != nil {
+		t.Fatalf("requeue failed: %v", err)
+	}
+	if _, err := mgr.RetryTask(ctx, task.ID); !errors.Is(err, ErrAlreadyRetried) {
+		t.Fatalf("expected ErrAlreadyRetried, got %v", err)
+	}
+}
+
+func TestRetriedTaskIsNotRequeuedAgain(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	root := &model.Task{Type: "pipeline"}
+	if err := mgr.Enqueue(ctx, root); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if _, err := mgr.Reserve(ctx); err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if err := mgr.Fail(ctx, root.ID, "boom"); err != nil {
+		t.Fatalf("fail failed: %v", err)
+	}
+	entries, err := mgr.ListDeadLetters(ctx, nil, 0, 0)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one dead letter, got %d (%v)", len(entries), err)
+	}
+
+	retries, err := mgr.RetryFailedSubtree(ctx, root.ID)
+	if err != nil || len(retries) != 1 {
+		t.Fatalf("expected one retry, got %d (%v)", len(retries), err)
+	}
+	if unhandled, _ := mgr.ListDeadLetters(ctx, map[string]interface{}{"handled": false}, 0, 0); len(unhandled) != 0 {
+		t.Fatalf("expected the retry to mark the dead letter handled, got %d unhandled", len(unhandled))
+	}
+	if _, err := mgr.RequeueDeadLetter(ctx, entries[0].ID, nil); !errors.Is(err, ErrDeadLetterHandled) {
+		t.Fatalf("expected ErrDeadLetterHandled, got %v", err)
+	}
+	if _, err := mgr.RetryTask(ctx, root.ID); !errors.Is(err, ErrAlreadyRetried) {
+		t.Fatalf("expected ErrAlreadyRetried, got %v", err)
+	}
+
+	var attempts int64
+	if err := mgr.db.Model(&model.Task{}).Where("retry_of_id = ?", root.ID).Count(&attempts).Error; err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected a single retry of the task, got %d", attempts)
+	}
+}
+
+func TestMarkDeadLetterHandled(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+
+	entry := model.DeadLetterQueue{TaskID: 1, FailedAt: time.Now().UTC(), ErrorMessage: "boom"}
+	if err := db.Create(&entry).Error; err != nil {
+		t.Fatalf("failed to seed dead letter: %v", err)
+	}
+	if err := mgr.MarkDeadLetterHandled(ctx, entry.ID); err != nil {
+		t.Fatalf("mark handled failed: %v", err)
+	}
+	entries, err := mgr.ListDeadLetters(ctx, map[string]interface{}{"handled": true}, 0, 0)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one handled entry, got %d (%v)", len(entries), err)
+	}
+	if err := mgr.MarkDeadLetterHandled(ctx, uuid.New()); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
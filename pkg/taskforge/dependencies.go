@@ -0,0 +1,163 @@
+package taskforge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// DependencyFailure decides what happens to a pending task when one of its
+// dependencies fails or is cancelled without a retry to take its place.
+type DependencyFailure string
+
+const (
+	DependencyBlock DependencyFailure = "block" // stay pending until the dependency is requeued or the task is cancelled
+	DependencyFail  DependencyFailure = "fail"  // fail the task, and in turn its own dependents
+)
+
+// dependencyFilter excludes tasks with a dependency that has not succeeded. A
+// dependency whose task no longer exists is never satisfied.
+const dependencyFilter = "NOT EXISTS (SELECT 1 FROM task_dependencies AS dep WHERE dep.task_id = tasks.friendly_id AND dep.deleted_at IS NULL " +
+	"AND NOT EXISTS (SELECT 1 FROM tasks AS req WHERE req.friendly_id = dep.depends_on_id AND req.status = ?))"
+
+// resolveDependencies loads the tasks t depends on. A dependency that has been
+// retried resolves to its latest attempt, so the dependent waits for the
+// retry rather than the failure.
+func (m *Manager) resolveDependencies(db *gorm.DB, t *model.Task) ([]model.Task, error) {
+	switch DependencyFailure(t.DependencyFailure) {
+	case "", DependencyBlock, DependencyFail:
+	default:
+		return nil, fmt.Errorf("%w: unknown failure policy %q", ErrInvalidDependency, t.DependencyFailure)
+	}
+
+	deps := make([]model.Task, 0, len(t.DependsOn))
+	seen := make(map[uuid.UUID]bool)
+	for _, id := range t.DependsOn {
+		var found []model.Task
+		if err := db.Where("id = ?", id).Limit(1).Find(&found).Error; err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("%w: task %s not found", ErrInvalidDependency, id)
+		}
+		dep, err := latestAttempt(db, found[0])
+		if err != nil {
+			return nil, err
+		}
+		if !seen[dep.ID] {
+			seen[dep.ID] = true
+			deps = append(deps, dep)
+		}
+	}
+	return deps, nil
+}
+
+// latestAttempt follows the retries of t and returns the most recent attempt,
+// which is t itself if it was never retried.
+func latestAttempt(db *gorm.DB, t model.Task) (model.Task, error) {
+	for {
+		var retries []model.Task
+		if err := db.Where("retry_of_id = ?", t.ID).Order("friendly_id DESC").Limit(1).Find(&retries).Error; err != nil {
+			return t, err
+		}
+		if len(retries) == 0 {
+			return t, nil
+		}
+		t = retries[0]
+	}
+}
+
+// addDependencies records that t depends on deps.
+func (m *Manager) addDependencies(db *gorm.DB, t *model.Task, deps []model.Task) error {
+	edges := make([]model.TaskDependency, len(deps))
+	for i, dep := range deps {
+		edges[i] = model.TaskDependency{TaskID: t.FriendlyID, DependsOnID: dep.FriendlyID}
+	}
+	return db.Create(&edges).Error
+}
+
+// checkDependencies applies t's failure policy right away if one of its
+// dependencies had already failed for good when t was enqueued.
+func (m *Manager) checkDependencies(ctx context.Context, t *model.Task, deps []model.Task) error {
+	if DependencyFailure(t.DependencyFailure) != DependencyFail {
+		return nil
+	}
+	for i := range deps {
+		switch Status(deps[i].Status) {
+		case StatusFailed, StatusCancelled:
+		default:
+			continue
+		}
+		if err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return m.failDependents(ctx, tx, &deps[i])
+		}); err != nil {
+			return err
+		}
+		return m.db.WithContext(ctx).First(t, "id = ?", t.ID).Error
+	}
+	return nil
+}
+
+// moveDependents points the dependents of a failed task at its retry, so they
+// wait for the retry instead.
+func (m *Manager) moveDependents(db *gorm.DB, from, to *model.Task) error {
+	return db.Model(&model.TaskDependency{}).
+		Where("depends_on_id = ?", from.FriendlyID).
+		Update("depends_on_id", to.FriendlyID).Error
+}
+
+// failDependents fails every pending dependent of dep, a task that ended
+// without succeeding, whose policy is DependencyFail. The failure cascades to
+// their own dependents. Dependents that block are left pending.
+func (m *Manager) failDependents(ctx context.Context, db *gorm.DB, dep *model.Task) error {
+	var dependents []model.Task
+	if err := db.WithContext(ctx).
+		Where("status = ? AND dependency_failure = ?", string(StatusPending), string(DependencyFail)).
+		Where("friendly_id IN (?)", db.Model(&model.TaskDependency{}).Select("task_id").Where("depends_on_id = ?", dep.FriendlyID)).
+		Order("friendly_id").
+		Find(&dependents).Error; err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("dependency %s %s", dep.ID, dep.Status)
+	for i := range dependents {
+		ok, err := m.setStatus(ctx, db, &dependents[i], StatusFailed, msg, map[string]interface{}{"last_error": msg})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if m.logger != nil {
+			m.logger.Infof("Failing task ID=%s: %s", dependents[i].ID, msg)
+		}
+		if err := m.finished(ctx, db, &dependents[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WaitingOn returns the dependencies of a task that have not succeeded yet, in
+// the order they were declared. A retried dependency is reported as its latest
+// attempt.
+func (m *Manager) WaitingOn(ctx context.Context, id uuid.UUID) ([]model.Task, error) {
+	db := m.db.WithContext(ctx)
+	var t model.Task
+	if err := db.First(&t, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	deps := []model.Task{}
+	if err := db.Unscoped().
+		Joins("JOIN task_dependencies AS dep ON dep.depends_on_id = tasks.friendly_id AND dep.deleted_at IS NULL").
+		Where("dep.task_id = ? AND tasks.status <> ?", t.FriendlyID, string(StatusSucceeded)).
+		Order("dep.id").
+		Find(&deps).Error; err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
@@ -0,0 +1,151 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestReserveWaitsForDependencies(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	extract := &model.Task{Type: "extract", Priority: 1}
+	if err := mgr.Enqueue(ctx, extract); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	transform := &model.Task{Type: "transform", Priority: 9, DependsOn: []uuid.UUID{extract.ID}}
+	if err := mgr.Enqueue(ctx, transform); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	waiting, err := mgr.WaitingOn(ctx, transform.ID)
+	if err != nil || len(waiting) != 1 || waiting[0].ID != extract.ID {
+		t.Fatalf("expected transform to wait on extract, got %v (%v)", waiting, err)
+	}
+
+	got, err := mgr.Reserve(ctx)
+	if err != nil || got.ID != extract.ID {
+		t.Fatalf("expected extract to be reserved first despite its lower priority, got %v (%v)", got, err)
+	}
+	if _, err := mgr.Reserve(ctx); err == nil {
+		t.Fatalf("expected transform to stay blocked while extract runs")
+	}
+	if err := mgr.Complete(ctx, extract.ID, true); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+
+	got, err = mgr.Reserve(ctx)
+	if err != nil || got.ID != transform.ID {
+		t.Fatalf("expected transform once extract succeeded, got %v (%v)", got, err)
+	}
+	waiting, err = mgr.WaitingOn(ctx, transform.ID)
+	if err != nil || len(waiting) != 0 {
+		t.Fatalf("expected nothing left to wait on, got %v (%v)", waiting, err)
+	}
+
+	missing := &model.Task{Type: "load", DependsOn: []uuid.UUID{uuid.New()}}
+	if err := mgr.Enqueue(ctx, missing); !errors.Is(err, ErrInvalidDependency) {
+		t.Fatalf("expected ErrInvalidDependency, got %v", err)
+	}
+}
+
+func TestDependentsFollowRetries(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{Retry: RetryPolicy{Attempts: 2}})
+
+	dep := &model.Task{Type: "fetch"}
+	if err := mgr.Enqueue(ctx, dep); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	dependent := &model.Task{Type: "parse", DependsOn: []uuid.UUID{dep.ID}, DependencyFailure: string(DependencyFail)}
+	if err := mgr.Enqueue(ctx, dependent); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	if _, err := mgr.Reserve(ctx); err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if err := mgr.Fail(ctx, dep.ID, "timeout"); err != nil {
+		t.Fatalf("fail failed: %v", err)
+	}
+
+	// The dependency is retried, so the dependent waits for the retry.
+	waiting, err := mgr.WaitingOn(ctx, dependent.ID)
+	if err != nil || len(waiting) != 1 || waiting[0].RetryOfID == nil || *waiting[0].RetryOfID != dep.ID {
+		t.Fatalf("expected dependent to wait on the retry, got %v (%v)", waiting, err)
+	}
+	retry := waiting[0]
+
+	// With no attempts left the failure cascades to the dependent.
+	if err := db.Model(&retry).UpdateColumn("scheduled_for", nil).Error; err != nil {
+		t.Fatalf("failed to make retry due: %v", err)
+	}
+	if _, err := mgr.Reserve(ctx); err != nil {
+		t.Fatalf("reserve of retry failed: %v", err)
+	}
+	if err := mgr.Fail(ctx, retry.ID, "timeout"); err != nil {
+		t.Fatalf("fail failed: %v", err)
+	}
+	got, err := mgr.GetTask(ctx, dependent.ID)
+	if err != nil {
+		t.Fatalf("get task failed: %v", err)
+	}
+	if got.Status != string(StatusFailed) || got.LastError == "" {
+		t.Fatalf("expected dependent to fail with its dependency, got %s (%q)", got.Status, got.LastError)
+	}
+
+	// A task enqueued against the failed chain fails immediately.
+	late := &model.Task{Type: "parse", DependsOn: []uuid.UUID{dep.ID}, DependencyFailure: string(DependencyFail)}
+	if err := mgr.Enqueue(ctx, late); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if late.Status != string(StatusFailed) {
+		t.Fatalf("expected a dependent of a failed task to fail on enqueue, got %s", late.Status)
+	}
+}
+
+func TestBlockedDependentResumesAfterRequeue(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{Retry: RetryPolicy{Attempts: 1}})
+
+	dep := &model.Task{Type: "fetch"}
+	if err := mgr.Enqueue(ctx, dep); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	blocked := &model.Task{Type: "parse", DependsOn: []uuid.UUID{dep.ID}}
+	if err := mgr.Enqueue(ctx, blocked); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if _, err := mgr.Reserve(ctx); err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if err := mgr.Fail(ctx, dep.ID, "boom"); err != nil {
+		t.Fatalf("fail failed: %v", err)
+	}
+
+	got, err := mgr.GetTask(ctx, blocked.ID)
+	if err != nil || got.Status != string(StatusPending) {
+		t.Fatalf("expected blocked dependent to stay pending, got %v (%v)", got, err)
+	}
+	if _, err := mgr.Reserve(ctx); err == nil {
+		t.Fatalf("expected blocked dependent not to be reserved")
+	}
+
+	letters, err := mgr.ListDeadLetters(ctx, nil, 0, 0)
+	if err != nil || len(letters) != 1 {
+		t.Fatalf("expected one dead letter, got %d (%v)", len(letters), err)
+	}
+	requeued, err := mgr.RequeueDeadLetter(ctx, letters[0].ID, nil)
+	if err != nil {
+		t.Fatalf("requeue failed: %v", err)
+	}
+	waiting, err := mgr.WaitingOn(ctx, blocked.ID)
+	if err != nil || len(waiting) != 1 || waiting[0].ID != requeued.ID {
+		t.Fatalf("expected dependent to wait on the requeued task, got %v (%v)", waiting, err)
+	}
+}
@@ -43,9 +43,15 @@
 // Tasks transition through the following states:
 //
 //	Pending → InProgress → Succeeded
-//	       ↘            ↘ Failed
-//	         → PendingCancellation → Cancelled
-//
+//	   │              ↘ WaitingOnChildren → Succeeded | Failed
+//	   │              ↘ Failed
+//	   │               ↘ PendingCancellation → Cancelled
+//	   │                                    ↘ FailedToCancel → Succeeded | Failed
+//	   ├→ Failed (a dependency failed)
+//	   ├→ Expired (not started by ExpiresAt)
+//	   ↘ Cancelled
+//
+// Moves outside this lifecycle are rejected with ErrInvalidTransition.
 // Failed tasks can be retried, which creates a new task linked to the original.
 //
 // # Architecture
@@ -55,6 +61,7 @@
 //   - pkg/taskforge: Manager, Status, Config (this package)
 //   - pkg/model: Domain models (Task, TaskTemplate, Worker)
 //   - pkg/scheduler: Cron-based recurring task scheduler
+//   - pkg/worker: Polling worker runtime that dispatches tasks to handlers by type
 //   - internal/: HTTP handlers, persistence, configuration loading
 //
 // For the default server implementation, see cmd/taskforge.
@@ -0,0 +1,52 @@
+package taskforge
+
+import "errors"
+
+var (
+	// ErrInvalidStatus is returned when a status is not part of the task lifecycle.
+	ErrInvalidStatus = errors.New("taskforge: invalid status")
+
+	// ErrInvalidTransition is returned when the task lifecycle does not allow
+	// moving from the task's current status to the requested one.
+	ErrInvalidTransition = errors.New("taskforge: invalid status transition")
+
+	// ErrStatusChange is returned when UpdateTask is asked to change a
+	// task's status, which only UpdateStatus may do.
+	ErrStatusChange = errors.New("taskforge: task status can only be changed with UpdateStatus")
+
+	// ErrTaskNotPending is returned when an operation requires a pending task.
+	ErrTaskNotPending = errors.New("taskforge: task is not pending")
+
+	// ErrTaskNotInProgress is returned when an operation requires an in-progress task.
+	ErrTaskNotInProgress = errors.New("taskforge: task is not in progress")
+
+	// ErrConcurrentUpdate is returned when a task's status changed while an
+	// operation was trying to change it.
+	ErrConcurrentUpdate = errors.New("taskforge: task was modified concurrently")
+
+	// ErrTaskConflict is returned when enqueueing a unique task while another
+	// task with the same type and reference ID is pending or still running,
+	// and the conflict policy is reject, or replace against a running task.
+	ErrTaskConflict = errors.New("taskforge: an active task with the same type and reference already exists")
+
+	// ErrIdempotencyKeyUsed is returned by EnqueueBatch when two tasks of the
+	// batch share an idempotency key, or another enqueue takes one of the
+	// batch's keys while the batch is inserted.
+	ErrIdempotencyKeyUsed = errors.New("taskforge: idempotency key already used")
+
+	// ErrInvalidDependency is returned when a task is enqueued with a
+	// dependency that does not exist or an unknown dependency failure policy.
+	ErrInvalidDependency = errors.New("taskforge: invalid dependency")
+
+	// ErrTaskNotCancelling is returned when acknowledging a cancellation that
+	// was never requested or has already been resolved.
+	ErrTaskNotCancelling = errors.New("taskforge: task is not pending cancellation")
+
+	// ErrAlreadyRetried is returned when retrying or requeueing a task that
+	// already has a retry.
+	ErrAlreadyRetried = errors.New("taskforge: task already has a retry")
+
+	// ErrDeadLetterHandled is returned when requeueing a dead letter entry that
+	// has already been handled.
+	ErrDeadLetterHandled = errors.New("taskforge: dead letter entry already handled")
+)
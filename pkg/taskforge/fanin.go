@@ -0,0 +1,199 @@
+package taskforge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// ChildPolicy decides whether a task that waited on its children succeeds once
+// they have all finished. Tasks without a policy do not wait for children.
+type ChildPolicy string
+
+const (
+	ChildrenAll       ChildPolicy = "all"       // every child must succeed
+	ChildrenAny       ChildPolicy = "any"       // at least one child must succeed
+	ChildrenThreshold ChildPolicy = "threshold" // at least Task.ChildThreshold of the children must succeed
+)
+
+// FanInResult is the payload of the callback task enqueued when a task that
+// waited on its children resolves.
+type FanInResult struct {
+	TaskID    uuid.UUID `json:"task_id"`
+	Status    Status    `json:"status"`
+	Children  int       `json:"children"`
+	Succeeded int       `json:"succeeded"`
+}
+
+// validateChildPolicy rejects unknown child policies and thresholds outside
+// (0, 1].
+func validateChildPolicy(t *model.Task) error {
+	switch ChildPolicy(t.ChildPolicy) {
+	case "", ChildrenAll, ChildrenAny:
+		return nil
+	case ChildrenThreshold:
+		if t.ChildThreshold <= 0 || t.ChildThreshold > 1 {
+			return fmt.Errorf("taskforge: child threshold must be in (0, 1], got %v", t.ChildThreshold)
+		}
+		return nil
+	}
+	return fmt.Errorf("taskforge: invalid child policy %q", t.ChildPolicy)
+}
+
+// succeed completes t. A task with a child policy and children moves to
+// waiting_on_children instead, and is resolved right away if its children
+// have already finished.
+func (m *Manager) succeed(ctx context.Context, db *gorm.DB, t *model.Task) (bool, error) {
+	if t.ChildPolicy != "" && Status(t.Status) == StatusInProgress {
+		var children int64
+		if err := db.WithContext(ctx).Model(&model.Task{}).
+			Where("parent_task_id = ? AND retry_of_id IS NULL", t.ID).
+			Count(&children).Error; err != nil {
+			return false, err
+		}
+		if children > 0 {
+			ok, err := m.setStatus(ctx, db, t, StatusWaiting, "", nil)
+			if !ok || err != nil {
+				return ok, err
+			}
+			return true, m.resolveChildren(ctx, db, t)
+		}
+	}
+	ok, err := m.setStatus(ctx, db, t, StatusSucceeded, "", nil)
+	if !ok || err != nil {
+		return ok, err
+	}
+	return true, m.finished(ctx, db, t)
+}
+
+// finished runs the follow-ups of t reaching a final status: if t did not
+// succeed its dependents are failed according to their policy, and a parent
+// waiting on t is resolved if t was its last unfinished child.
+func (m *Manager) finished(ctx context.Context, db *gorm.DB, t *model.Task) error {
+	if Status(t.Status) != StatusSucceeded {
+		if err := m.failDependents(ctx, db, t); err != nil {
+			return err
+		}
+	}
+	return m.resolveParent(ctx, db, t)
+}
+
+// resolveParent resolves the parent of t if it is waiting on its children.
+// Retries are created as children of the attempt they replace, so the chain
+// is followed back to the first attempt to find the real parent.
+func (m *Manager) resolveParent(ctx context.Context, db *gorm.DB, t *model.Task) error {
+	origin := *t
+	for origin.RetryOfID != nil {
+		var previous model.Task
+		if err := db.WithContext(ctx).Unscoped().Take(&previous, "id = ?", *origin.RetryOfID).Error; err != nil {
+			return err
+		}
+		origin = previous
+	}
+	if origin.ParentTaskID == nil {
+		return nil
+	}
+
+	// Locking the parent serialises siblings that finish at the same time, so
+	// the last of them sees every other outcome.
+	var parents []model.Task
+	if err := db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND status = ?", *origin.ParentTaskID, string(StatusWaiting)).
+		Limit(1).
+		Find(&parents).Error; err != nil {
+		return err
+	}
+	if len(parents) == 0 {
+		return nil
+	}
+	return m.resolveChildren(ctx, db, &parents[0])
+}
+
+// resolveChildren decides the outcome of parent, which is waiting on its
+// children, once the latest attempt of every child has finished. It then
+// enqueues the parent's callback task, if any.
+func (m *Manager) resolveChildren(ctx context.Context, db *gorm.DB, parent *model.Task) error {
+	var children []model.Task
+	if err := db.WithContext(ctx).
+		Where("parent_task_id = ? AND retry_of_id IS NULL", parent.ID).
+		Find(&children).Error; err != nil {
+		return err
+	}
+	succeeded := 0
+	for _, child := range children {
+		latest, err := latestAttempt(db.WithContext(ctx), child)
+		if err != nil {
+			return err
+		}
+		if !Status(latest.Status).IsTerminal() {
+			return nil
+		}
+		if Status(latest.Status) == StatusSucceeded {
+			succeeded++
+		}
+	}
+
+	var passed bool
+	switch ChildPolicy(parent.ChildPolicy) {
+	case ChildrenAny:
+		passed = succeeded > 0
+	case ChildrenThreshold:
+		passed = float64(succeeded) >= parent.ChildThreshold*float64(len(children))
+	default:
+		passed = succeeded == len(children)
+	}
+	to := StatusSucceeded
+	var extra map[string]interface{}
+	msg := fmt.Sprintf("%d of %d children succeeded", succeeded, len(children))
+	if !passed {
+		to = StatusFailed
+		extra = map[string]interface{}{"last_error": msg}
+	}
+	ok, err := m.setStatus(ctx, db, parent, to, msg, extra)
+	if !ok || err != nil {
+		return err
+	}
+	if m.logger != nil {
+		m.logger.Infof("Task ID=%s %s: %s", parent.ID, to, msg)
+	}
+
+	if parent.CallbackType != "" {
+		if err := m.enqueueCallback(ctx, db, parent, FanInResult{
+			TaskID:    parent.ID,
+			Status:    to,
+			Children:  len(children),
+			Succeeded: succeeded,
+		}); err != nil {
+			return err
+		}
+	}
+	return m.finished(ctx, db, parent)
+}
+
+// enqueueCallback creates the callback task of parent, with result as its
+// payload, in the same queue and for the same reference.
+func (m *Manager) enqueueCallback(ctx context.Context, db *gorm.DB, parent *model.Task, result FanInResult) error {
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	callback := model.Task{
+		Type:         parent.CallbackType,
+		Queue:        parent.Queue,
+		ReferenceID:  parent.ReferenceID,
+		Status:       string(StatusPending),
+		Priority:     parent.Priority,
+		Payload:      string(payload),
+		ParentTaskID: &parent.ID,
+	}
+	if err := db.WithContext(ctx).Create(&callback).Error; err != nil {
+		return fmt.Errorf("taskforge: failed to enqueue callback: %w", err)
+	}
+	return m.recordHistory(ctx, db, []model.Task{callback}, "", fmt.Sprintf("callback of task %s", parent.ID))
+}
@@ -0,0 +1,140 @@
+package taskforge
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// startTask enqueues task and reserves it.
+func startTask(t *testing.T, mgr *Manager, task *model.Task) {
+	t.Helper()
+	if err := mgr.Enqueue(context.Background(), task); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	reserveTask(t, mgr, task.ID)
+}
+
+// reserveTask reserves the next task and checks that it is the one with id.
+func reserveTask(t *testing.T, mgr *Manager, id uuid.UUID) {
+	t.Helper()
+	got, err := mgr.Reserve(context.Background())
+	if err != nil {
+		t.Fatalf("failed to start task: %v", err)
+	}
+	if got.ID != id {
+		t.Fatalf("expected to reserve task %s, got %s", id, got.ID)
+	}
+}
+
+func assertStatus(t *testing.T, mgr *Manager, id uuid.UUID, want Status) {
+	t.Helper()
+	got, err := mgr.GetTask(context.Background(), id)
+	if err != nil {
+		t.Fatalf("get task failed: %v", err)
+	}
+	if got.Status != string(want) {
+		t.Fatalf("expected task %s to be %s, got %s", id, want, got.Status)
+	}
+}
+
+func TestParentWaitsOnChildrenAndEnqueuesCallback(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{Retry: RetryPolicy{Attempts: 1}})
+
+	parent := &model.Task{Type: "import", ChildPolicy: string(ChildrenAll), CallbackType: "notify"}
+	startTask(t, mgr, parent)
+	first := &model.Task{Type: "import-part", ParentTaskID: &parent.ID}
+	second := &model.Task{Type: "import-part", ParentTaskID: &parent.ID}
+	startTask(t, mgr, first)
+	startTask(t, mgr, second)
+
+	if err := mgr.Complete(ctx, parent.ID, true); err != nil {
+		t.Fatalf("complete of parent failed: %v", err)
+	}
+	assertStatus(t, mgr, parent.ID, StatusWaiting)
+
+	if err := mgr.Complete(ctx, first.ID, true); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	assertStatus(t, mgr, parent.ID, StatusWaiting)
+
+	if err := mgr.Fail(ctx, second.ID, "bad file"); err != nil {
+		t.Fatalf("fail failed: %v", err)
+	}
+	assertStatus(t, mgr, parent.ID, StatusFailed)
+
+	var callbacks []model.Task
+	if err := db.Where("type = ?", "notify").Find(&callbacks).Error; err != nil {
+		t.Fatalf("failed to load callbacks: %v", err)
+	}
+	if len(callbacks) != 1 {
+		t.Fatalf("expected one callback task, got %d", len(callbacks))
+	}
+	var result FanInResult
+	if err := json.Unmarshal([]byte(callbacks[0].Payload), &result); err != nil {
+		t.Fatalf("failed to parse callback payload: %v", err)
+	}
+	if result.TaskID != parent.ID || result.Status != StatusFailed || result.Children != 2 || result.Succeeded != 1 {
+		t.Fatalf("unexpected callback payload: %+v", result)
+	}
+}
+
+func TestChildThresholdCountsRetries(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{Retry: RetryPolicy{Attempts: 2}})
+
+	parent := &model.Task{Type: "crawl", ChildPolicy: string(ChildrenThreshold), ChildThreshold: 0.5}
+	startTask(t, mgr, parent)
+	flaky := &model.Task{Type: "crawl-page", ParentTaskID: &parent.ID}
+	startTask(t, mgr, flaky)
+	if err := mgr.Complete(ctx, parent.ID, true); err != nil {
+		t.Fatalf("complete of parent failed: %v", err)
+	}
+
+	// The failed child is retried, so the parent keeps waiting.
+	if err := mgr.Fail(ctx, flaky.ID, "timeout"); err != nil {
+		t.Fatalf("fail failed: %v", err)
+	}
+	assertStatus(t, mgr, parent.ID, StatusWaiting)
+
+	var retry model.Task
+	if err := db.Where("retry_of_id = ?", flaky.ID).Take(&retry).Error; err != nil {
+		t.Fatalf("expected a retry: %v", err)
+	}
+	if err := db.Model(&retry).Update("scheduled_for", nil).Error; err != nil {
+		t.Fatalf("failed to make the retry due: %v", err)
+	}
+	reserveTask(t, mgr, retry.ID)
+	if err := mgr.Complete(ctx, retry.ID, true); err != nil {
+		t.Fatalf("complete of retry failed: %v", err)
+	}
+	assertStatus(t, mgr, parent.ID, StatusSucceeded)
+}
+
+func TestParentResolvesWhenChildrenAlreadyFinished(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	parent := &model.Task{Type: "scan", ChildPolicy: string(ChildrenAny)}
+	startTask(t, mgr, parent)
+	child := &model.Task{Type: "scan-host", ParentTaskID: &parent.ID}
+	startTask(t, mgr, child)
+	if err := mgr.Complete(ctx, child.ID, true); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+
+	if err := mgr.Complete(ctx, parent.ID, true); err != nil {
+		t.Fatalf("complete of parent failed: %v", err)
+	}
+	assertStatus(t, mgr, parent.ID, StatusSucceeded)
+
+	invalid := &model.Task{Type: "scan", ChildPolicy: string(ChildrenThreshold), ChildThreshold: 2}
+	if err := mgr.Enqueue(ctx, invalid); err == nil {
+		t.Fatalf("expected a threshold above 1 to be rejected")
+	}
+}
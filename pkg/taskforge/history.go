@@ -0,0 +1,96 @@
+package taskforge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+type actorKey struct{}
+
+// WithActor returns a context that attributes task status changes made with it
+// to actor (a user, service, or worker name) in the task history.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored by WithActor, or "" if none is set.
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// setStatus moves t from its current status to the given one and appends a
+// TaskHistory row, both on db. Transitions the lifecycle does not allow fail
+// with ErrInvalidStatus or ErrInvalidTransition. The update only applies while
+// the stored status still equals t.Status, so it reports false without writing
+// anything when another caller changed the task first. Extra column updates
+// are applied in the same statement. On success t.Status is updated in place.
+func (m *Manager) setStatus(ctx context.Context, db *gorm.DB, t *model.Task, to Status, msg string, extra map[string]interface{}) (bool, error) {
+	if !to.IsValid() {
+		return false, fmt.Errorf("%w: %q", ErrInvalidStatus, to)
+	}
+	if from := Status(t.Status); !from.CanTransitionTo(to) {
+		return false, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+
+	updates := map[string]interface{}{"status": string(to)}
+	for k, v := range extra {
+		updates[k] = v
+	}
+
+	res := db.WithContext(ctx).
+		Model(&model.Task{}).
+		Where("id = ? AND status = ?", t.ID, t.Status).
+		Updates(updates)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+
+	from := Status(t.Status)
+	t.Status = string(to)
+	if err := m.recordHistory(ctx, db, []model.Task{*t}, from, msg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// recordHistory appends one TaskHistory row per task for a transition from
+// the given status (empty for newly created tasks) to each task's current status.
+func (m *Manager) recordHistory(ctx context.Context, db *gorm.DB, tasks []model.Task, from Status, msg string) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	actor := ActorFromContext(ctx)
+	rows := make([]model.TaskHistory, len(tasks))
+	for i, t := range tasks {
+		rows[i] = model.TaskHistory{
+			TaskID:     t.FriendlyID,
+			FromStatus: string(from),
+			Status:     t.Status,
+			Message:    msg,
+			Actor:      actor,
+		}
+	}
+	return db.WithContext(ctx).Create(&rows).Error
+}
+
+// GetTaskHistory returns the status timeline of a task, oldest first.
+func (m *Manager) GetTaskHistory(ctx context.Context, id uuid.UUID) ([]model.TaskHistory, error) {
+	t, err := m.GetTask(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var history []model.TaskHistory
+	if err := m.db.WithContext(ctx).
+		Where("task_id = ?", t.FriendlyID).
+		Order("created_at, id").
+		Find(&history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
@@ -0,0 +1,73 @@
+package taskforge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestStatusTransitionsAreRecordedInHistory(t *testing.T) {
+	ctx := WithActor(context.Background(), "alice")
+	mgr, _ := newTestManager(t, Config{Retry: RetryPolicy{Attempts: 2, Backoff: time.Minute}})
+
+	task := &model.Task{Type: "audited"}
+	if err := mgr.Enqueue(ctx, task); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if _, err := mgr.Reserve(ctx); err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if err := mgr.Complete(ctx, task.ID, false); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+
+	history, err := mgr.GetTaskHistory(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("get history failed: %v", err)
+	}
+	want := []struct{ from, to Status }{
+		{StatusPending, StatusInProgress},
+		{StatusInProgress, StatusFailed},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("expected %d history rows, got %d", len(want), len(history))
+	}
+	for i, w := range want {
+		h := history[i]
+		if h.FromStatus != string(w.from) || h.Status != string(w.to) {
+			t.Fatalf("row %d: expected %s -> %s, got %s -> %s", i, w.from, w.to, h.FromStatus, h.Status)
+		}
+		if h.Actor != "alice" {
+			t.Fatalf("row %d: expected actor alice, got %q", i, h.Actor)
+		}
+		if h.CreatedAt.IsZero() {
+			t.Fatalf("row %d: expected a timestamp", i)
+		}
+	}
+
+	retries, err := mgr.List(ctx, map[string]interface{}{"status": string(StatusPending)}, 0, 0)
+	if err != nil || len(retries) != 1 {
+		t.Fatalf("expected one pending retry, got %d (%v)", len(retries), err)
+	}
+	retryHistory, err := mgr.GetTaskHistory(ctx, retries[0].ID)
+	if err != nil {
+		t.Fatalf("get retry history failed: %v", err)
+	}
+	if len(retryHistory) != 1 || retryHistory[0].FromStatus != "" || retryHistory[0].Status != string(StatusPending) {
+		t.Fatalf("expected retry creation to be recorded, got %+v", retryHistory)
+	}
+
+	if err := mgr.CancelTask(WithActor(context.Background(), "bob"), retries[0].ID); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	retryHistory, err = mgr.GetTaskHistory(ctx, retries[0].ID)
+	if err != nil {
+		t.Fatalf("get retry history failed: %v", err)
+	}
+	last := retryHistory[len(retryHistory)-1]
+	if last.Status != string(StatusCancelled) || last.Actor != "bob" {
+		t.Fatalf("expected cancellation by bob, got %s by %q", last.Status, last.Actor)
+	}
+}
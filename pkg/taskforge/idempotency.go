@@ -0,0 +1,36 @@
+package taskforge
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// findIdempotent returns the live task holding t's type and idempotency key,
+// or nil if there is none. A holder outside the window, or one that has been
+// deleted, gives up its key.
+func (m *Manager) findIdempotent(db *gorm.DB, t *model.Task) (*model.Task, error) {
+	var holders []model.Task
+	if err := db.Unscoped().
+		Where("type = ? AND idempotency_key = ?", t.Type, *t.IdempotencyKey).
+		Limit(1).
+		Find(&holders).Error; err != nil {
+		return nil, err
+	}
+	if len(holders) == 0 {
+		return nil, nil
+	}
+	holder := holders[0]
+	if !holder.DeletedAt.Valid && holder.CreatedAt.After(time.Now().Add(-m.dedupe)) {
+		return &holder, nil
+	}
+	if err := db.Unscoped().
+		Model(&model.Task{}).
+		Where("id = ?", holder.ID).
+		UpdateColumn("idempotency_key", nil).Error; err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
@@ -0,0 +1,87 @@
+package taskforge
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestEnqueueDeduplicatesIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{IdempotencyWindow: time.Hour})
+	key := "order-42"
+
+	first := &model.Task{Type: "charge", IdempotencyKey: &key, Payload: "first"}
+	if err := mgr.Enqueue(ctx, first); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	again := &model.Task{Type: "charge", IdempotencyKey: &key, Payload: "again"}
+	if err := mgr.CreateTask(ctx, again); err != nil {
+		t.Fatalf("repeated create failed: %v", err)
+	}
+	if again.ID != first.ID || again.Payload != "first" {
+		t.Fatalf("expected the existing task to be returned, got %s (%q)", again.ID, again.Payload)
+	}
+
+	otherType := &model.Task{Type: "refund", IdempotencyKey: &key}
+	if err := mgr.Enqueue(ctx, otherType); err != nil {
+		t.Fatalf("enqueue of another type failed: %v", err)
+	}
+	if otherType.ID == first.ID {
+		t.Fatalf("expected keys to be scoped by task type")
+	}
+
+	// Once the window has passed the key is released.
+	if err := db.Model(first).UpdateColumn("created_at", time.Now().Add(-2*time.Hour)).Error; err != nil {
+		t.Fatalf("failed to age task: %v", err)
+	}
+	later := &model.Task{Type: "charge", IdempotencyKey: &key}
+	if err := mgr.Enqueue(ctx, later); err != nil {
+		t.Fatalf("enqueue after window failed: %v", err)
+	}
+	if later.ID == first.ID {
+		t.Fatalf("expected a new task once the window expired")
+	}
+	stale, err := mgr.GetTask(ctx, first.ID)
+	if err != nil || stale.IdempotencyKey != nil {
+		t.Fatalf("expected the expired key to be released, got %v (%v)", stale.IdempotencyKey, err)
+	}
+}
+
+func TestConcurrentEnqueueWithSameKeyCreatesOneTask(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+	key := "webhook-7"
+
+	const producers = 8
+	ids := make(chan model.Task, producers)
+	var wg sync.WaitGroup
+	for i := 0; i < producers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task := &model.Task{Type: "deliver", IdempotencyKey: &key}
+			if err := mgr.Enqueue(ctx, task); err != nil {
+				t.Errorf("enqueue failed: %v", err)
+				return
+			}
+			ids <- *task
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	var count int64
+	db.Model(&model.Task{}).Where("type = ?", "deliver").Count(&count)
+	if count != 1 {
+		t.Fatalf("expected exactly one task, got %d", count)
+	}
+	for task := range ids {
+		if task.FriendlyID == 0 {
+			t.Fatalf("expected every producer to receive the stored task")
+		}
+	}
+}
@@ -20,12 +20,28 @@ type Logger interface {
 type TaskManager interface {
 	// Task lifecycle
 	Enqueue(ctx context.Context, t *model.Task) error
+	EnqueueAt(ctx context.Context, t *model.Task, runAt time.Time) error
+	EnqueueIn(ctx context.Context, t *model.Task, delay time.Duration) error
+	EnqueueBatch(ctx context.Context, tasks []*model.Task) error
 	Reserve(ctx context.Context) (*model.Task, error)
+	ReserveFor(ctx context.Context, opts ReserveOptions) (*model.Task, error)
+	ReserveN(ctx context.Context, n int, opts ReserveOptions) ([]model.Task, error)
 	UpdateStatus(ctx context.Context, id uuid.UUID, s Status) error
+	SetPriority(ctx context.Context, id uuid.UUID, priority int) error
 	Complete(ctx context.Context, id uuid.UUID, success bool) error
+	CompleteWithOutputs(ctx context.Context, id uuid.UUID, outputs map[string]string) error
+	Fail(ctx context.Context, id uuid.UUID, errMsg string) error
+	ExtendLease(ctx context.Context, id uuid.UUID, d time.Duration) (cancelRequested bool, err error)
+	Release(ctx context.Context, id uuid.UUID) error
+	ReportProgress(ctx context.Context, id uuid.UUID, delta Progress) error
 	CancelTask(ctx context.Context, id uuid.UUID) error
+	AcknowledgeCancel(ctx context.Context, id uuid.UUID, cancelled bool) error
 	RetryTask(ctx context.Context, id uuid.UUID) (*model.Task, error)
 	List(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]model.Task, error)
+	GetTaskHistory(ctx context.Context, id uuid.UUID) ([]model.TaskHistory, error)
+	SetOutput(ctx context.Context, taskID uuid.UUID, key, value string) error
+	GetOutputs(ctx context.Context, taskID uuid.UUID) (map[string]string, error)
+	WaitingOn(ctx context.Context, id uuid.UUID) ([]model.Task, error)
 
 	// Task CRUD
 	CreateTask(ctx context.Context, t *model.Task) error
@@ -46,15 +62,27 @@ type TaskManager interface {
 	RegisterWorker(ctx context.Context, w *model.WorkerRegistration) error
 	Heartbeat(ctx context.Context, workerID uuid.UUID) error
 
+	// Worker type operations
+	SetRateLimit(ctx context.Context, taskType string, limit int, period time.Duration) error
+	SetConcurrencyLimit(ctx context.Context, taskType string, limit int) error
+	Stats(ctx context.Context) ([]TypeStats, error)
+
 	// Queue operations
 	EnqueueJob(ctx context.Context, j *model.JobQueue) error
 	GetQueue(ctx context.Context) ([]model.JobQueue, error)
 	DequeueJob(ctx context.Context, id uuid.UUID) error
 
+	// Dead letter operations
+	ListDeadLetters(ctx context.Context, filter map[string]interface{}, limit, offset int) ([]model.DeadLetterQueue, error)
+	RequeueDeadLetter(ctx context.Context, id uuid.UUID, payload *string) (*model.Task, error)
+	MarkDeadLetterHandled(ctx context.Context, id uuid.UUID) error
+
 	// Child task operations
 	GetChildTasks(ctx context.Context, parentID uuid.UUID) ([]model.Task, error)
 	HasChildren(ctx context.Context, taskID uuid.UUID) (bool, error)
 	GetTaskTree(ctx context.Context, rootID uuid.UUID) (*TaskNode, error)
+	CancelTree(ctx context.Context, rootID uuid.UUID, opts CancelTreeOptions) (int, error)
+	RetryFailedSubtree(ctx context.Context, rootID uuid.UUID) ([]model.Task, error)
 }
 
 // TemplateScheduler defines the scheduler lifecycle hooks.
@@ -0,0 +1,187 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// ExtendLease pushes the lease of a running task to d from now. Long-running
+// workers call it periodically so the reaper does not reclaim their task. It
+// reports whether cancellation of the task has been requested, so the worker
+// can stop and call AcknowledgeCancel; the lease is extended either way. It
+// returns ErrTaskNotInProgress if the task is no longer running.
+func (m *Manager) ExtendLease(ctx context.Context, id uuid.UUID, d time.Duration) (cancelRequested bool, err error) {
+	if d <= 0 {
+		return false, fmt.Errorf("taskforge: lease duration must be positive, got %s", d)
+	}
+	now := time.Now().UTC()
+	res := m.db.WithContext(ctx).
+		Model(&model.Task{}).
+		Where("id = ? AND status = ?", id, string(StatusPendingCancel)).
+		Update("lease_expires_at", now.Add(d))
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return true, nil
+	}
+
+	// A task whose cancellation failed is still running until its worker
+	// reports the outcome.
+	res = m.db.WithContext(ctx).
+		Model(&model.Task{}).
+		Where("id = ? AND status IN ?", id, []string{string(StatusInProgress), string(StatusFailedToCancel)}).
+		Update("lease_expires_at", now.Add(d))
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		if _, err := m.GetTask(ctx, id); err != nil {
+			return false, err
+		}
+		return false, ErrTaskNotInProgress
+	}
+	return false, nil
+}
+
+// Release returns an in-progress task to pending without counting the attempt,
+// for a worker that stops before finishing it, e.g. when it shuts down. It
+// returns ErrTaskNotInProgress if the task is not in progress.
+func (m *Manager) Release(ctx context.Context, id uuid.UUID) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var t model.Task
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&t, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if Status(t.Status) != StatusInProgress {
+			return ErrTaskNotInProgress
+		}
+		if m.logger != nil {
+			m.logger.Infof("Releasing task ID=%s back to pending", t.ID)
+		}
+		ok, err := m.setStatus(ctx, tx, &t, StatusPending, releasedMessage, map[string]interface{}{
+			"started_at":       nil,
+			"lease_expires_at": nil,
+			"deadline_at":      nil,
+		})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrConcurrentUpdate
+		}
+		return nil
+	})
+}
+
+// ReapExpiredLeases reclaims running tasks whose lease has expired, which
+// happens when a worker crashes or loses its connection. In-progress tasks with
+// attempts left under their retry policy go back to pending with Attempt
+// incremented; the rest are failed and dead-lettered. Tasks awaiting
+// cancellation are cancelled, and tasks that failed to cancel are failed as
+// by Fail. It returns the number of tasks reclaimed.
+func (m *Manager) ReapExpiredLeases(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	var expired []model.Task
+	if err := m.db.WithContext(ctx).
+		Where("status IN ? AND lease_expires_at < ?", runningStatuses(), now).
+		Order("lease_expires_at").
+		Find(&expired).Error; err != nil {
+		return 0, err
+	}
+
+	reaped := 0
+	for i := range expired {
+		ok, err := m.reapTask(ctx, &expired[i], now)
+		if err != nil {
+			return reaped, err
+		}
+		if ok {
+			reaped++
+		}
+	}
+	return reaped, nil
+}
+
+// reapTask reclaims a single expired task. The lease is re-checked under a row
+// lock, so a worker that extends or completes the task concurrently wins.
+func (m *Manager) reapTask(ctx context.Context, t *model.Task, now time.Time) (bool, error) {
+	var reaped bool
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current model.Task
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status IN ? AND lease_expires_at < ?", t.ID, runningStatuses(), now).
+			Take(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch Status(current.Status) {
+		case StatusPendingCancel:
+			if m.logger != nil {
+				m.logger.Infof("Lease of task ID=%s expired while awaiting cancellation, cancelling it", current.ID)
+			}
+			reaped, err = m.setStatus(ctx, tx, &current, StatusCancelled, leaseExpiredMessage, nil)
+			if err != nil || !reaped {
+				return err
+			}
+			return m.finished(ctx, tx, &current)
+		case StatusFailedToCancel:
+			if m.logger != nil {
+				m.logger.Errorf("Lease of task ID=%s expired after its cancellation failed", current.ID)
+			}
+			if err := m.fail(ctx, tx, &current, leaseExpiredMessage); err != nil {
+				return err
+			}
+			reaped = true
+			return nil
+		}
+
+		policy, err := m.retryPolicyFor(ctx, tx, &current)
+		if err != nil {
+			return err
+		}
+
+		if !policy.allowsRetry(current.Attempt) {
+			if m.logger != nil {
+				m.logger.Errorf("Lease of task ID=%s expired with no attempts left", current.ID)
+			}
+			reaped, err = m.setStatus(ctx, tx, &current, StatusFailed, leaseExpiredMessage, map[string]interface{}{
+				"last_error": leaseExpiredMessage,
+			})
+			if err != nil || !reaped {
+				return err
+			}
+			return m.deadLetter(ctx, tx, &current, leaseExpiredMessage)
+		}
+
+		if m.logger != nil {
+			m.logger.Infof("Lease of task ID=%s expired, returning it to pending", current.ID)
+		}
+		reaped, err = m.setStatus(ctx, tx, &current, StatusPending, leaseExpiredMessage, map[string]interface{}{
+			"attempt":          gorm.Expr("attempt + 1"),
+			"started_at":       nil,
+			"lease_expires_at": nil,
+			"deadline_at":      nil,
+		})
+		return err
+	})
+	return reaped, err
+}
+
+// leaseExpiredMessage is the history message recorded when a lease is reaped.
+const leaseExpiredMessage = "lease expired"
+
+// releasedMessage is the history message recorded when a worker releases a task.
+const releasedMessage = "released by worker"
@@ -0,0 +1,178 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestReserveStampsLeaseAndExtendLease(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{LeaseDuration: time.Minute})
+
+	task := &model.Task{Type: "long"}
+	if err := mgr.Enqueue(ctx, task); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	before := time.Now().UTC()
+	reserved, err := mgr.Reserve(ctx)
+	if err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if reserved.StartedAt == nil || reserved.StartedAt.Before(before.Add(-time.Second)) {
+		t.Fatalf("expected StartedAt to be stamped, got %v", reserved.StartedAt)
+	}
+	if reserved.LeaseExpiresAt == nil || reserved.LeaseExpiresAt.Sub(*reserved.StartedAt) != time.Minute {
+		t.Fatalf("expected a one minute lease, got %v", reserved.LeaseExpiresAt)
+	}
+
+	if cancelRequested, err := mgr.ExtendLease(ctx, task.ID, time.Hour); err != nil || cancelRequested {
+		t.Fatalf("extend lease failed: %v (cancel requested: %v)", err, cancelRequested)
+	}
+	stored, err := mgr.GetTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("get task failed: %v", err)
+	}
+	if stored.LeaseExpiresAt == nil || stored.LeaseExpiresAt.Before(before.Add(59*time.Minute)) {
+		t.Fatalf("expected lease to be extended by an hour, got %v", stored.LeaseExpiresAt)
+	}
+
+	if err := mgr.Complete(ctx, task.ID, true); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	if _, err := mgr.ExtendLease(ctx, task.ID, time.Hour); !errors.Is(err, ErrTaskNotInProgress) {
+		t.Fatalf("expected ErrTaskNotInProgress, got %v", err)
+	}
+}
+
+func TestReapExpiredLeases(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{Retry: RetryPolicy{Attempts: 2}})
+
+	expired := time.Now().UTC().Add(-time.Minute)
+	live := time.Now().UTC().Add(time.Hour)
+	retryable := model.Task{Type: "crashy", Status: string(StatusInProgress), LeaseExpiresAt: &expired}
+	exhausted := model.Task{Type: "crashy", Status: string(StatusInProgress), Attempt: 1, LeaseExpiresAt: &expired}
+	healthy := model.Task{Type: "crashy", Status: string(StatusInProgress), LeaseExpiresAt: &live}
+	for _, task := range []*model.Task{&retryable, &exhausted, &healthy} {
+		if err := db.Create(task).Error; err != nil {
+			t.Fatalf("failed to seed task: %v", err)
+		}
+	}
+
+	reaped, err := mgr.ReapExpiredLeases(ctx)
+	if err != nil {
+		t.Fatalf("reap failed: %v", err)
+	}
+	if reaped != 2 {
+		t.Fatalf("expected 2 reaped tasks, got %d", reaped)
+	}
+
+	cases := []struct {
+		name    string
+		task    model.Task
+		status  Status
+		attempt int
+	}{
+		{"retryable", retryable, StatusPending, 1},
+		{"exhausted", exhausted, StatusFailed, 1},
+		{"healthy", healthy, StatusInProgress, 0},
+	}
+	for _, tc := range cases {
+		stored, err := mgr.GetTask(ctx, tc.task.ID)
+		if err != nil {
+			t.Fatalf("%s: get task failed: %v", tc.name, err)
+		}
+		if stored.Status != string(tc.status) {
+			t.Fatalf("%s: expected status %q, got %q", tc.name, tc.status, stored.Status)
+		}
+		if stored.Attempt != tc.attempt {
+			t.Fatalf("%s: expected attempt %d, got %d", tc.name, tc.attempt, stored.Attempt)
+		}
+	}
+	dead, err := mgr.ListDeadLetters(ctx, nil, 0, 0)
+	if err != nil || len(dead) != 1 {
+		t.Fatalf("expected one dead letter, got %d (%v)", len(dead), err)
+	}
+	if dead[0].TaskID != exhausted.FriendlyID || dead[0].ErrorMessage != leaseExpiredMessage {
+		t.Fatalf("expected the exhausted task to be dead-lettered, got %+v", dead[0])
+	}
+}
+
+func TestReapExpiredLeasesDuringCancellation(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+
+	expired := time.Now().UTC().Add(-time.Minute)
+	cancelling := model.Task{Type: "crashy", Status: string(StatusPendingCancel), LeaseExpiresAt: &expired}
+	stuck := model.Task{Type: "crashy", Status: string(StatusFailedToCancel), LeaseExpiresAt: &expired}
+	for _, task := range []*model.Task{&cancelling, &stuck} {
+		if err := db.Create(task).Error; err != nil {
+			t.Fatalf("failed to seed task: %v", err)
+		}
+	}
+
+	reaped, err := mgr.ReapExpiredLeases(ctx)
+	if err != nil {
+		t.Fatalf("reap failed: %v", err)
+	}
+	if reaped != 2 {
+		t.Fatalf("expected 2 reaped tasks, got %d", reaped)
+	}
+	for _, tc := range []struct {
+		name   string
+		task   model.Task
+		status Status
+	}{
+		{"cancelling", cancelling, StatusCancelled},
+		{"stuck", stuck, StatusFailed},
+	} {
+		stored, err := mgr.GetTask(ctx, tc.task.ID)
+		if err != nil {
+			t.Fatalf("%s: get task failed: %v", tc.name, err)
+		}
+		if stored.Status != string(tc.status) {
+			t.Fatalf("%s: expected status %q, got %q", tc.name, tc.status, stored.Status)
+		}
+	}
+
+	var running int64
+	db.Model(&model.Task{}).Where("status IN ?", runningStatuses()).Count(&running)
+	if running != 0 {
+		t.Fatalf("expected no task to keep a concurrency slot, got %d", running)
+	}
+}
+
+func TestReleaseReturnsTaskToPending(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	task := &model.Task{Type: "long"}
+	if err := mgr.Enqueue(ctx, task); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if _, err := mgr.Reserve(ctx); err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if err := mgr.Release(ctx, task.ID); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+
+	stored, err := mgr.GetTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("get task failed: %v", err)
+	}
+	if stored.Status != string(StatusPending) || stored.Attempt != 0 || stored.LeaseExpiresAt != nil {
+		t.Fatalf("expected a pending task on its first attempt without a lease, got %+v", stored)
+	}
+	if err := mgr.Release(ctx, task.ID); !errors.Is(err, ErrTaskNotInProgress) {
+		t.Fatalf("expected ErrTaskNotInProgress, got %v", err)
+	}
+	if got, err := mgr.Reserve(ctx); err != nil || got.ID != task.ID {
+		t.Fatalf("expected the released task to be reserved again, got %v (%v)", got, err)
+	}
+}
@@ -0,0 +1,192 @@
+package taskforge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// DefaultRatePeriod is the window of a rate limit whose period is not set.
+const DefaultRatePeriod = time.Second
+
+// SetRateLimit limits how many tasks of taskType may start per period across
+// every worker sharing the database. A limit of 0 removes the limit. The
+// worker type is created if it does not exist yet.
+func (m *Manager) SetRateLimit(ctx context.Context, taskType string, limit int, period time.Duration) error {
+	if limit < 0 || period < 0 {
+		return fmt.Errorf("taskforge: rate limit and period must not be negative")
+	}
+	return m.setTypeLimits(ctx, model.WorkerType{Name: taskType, RateLimit: limit, RatePeriod: period}, "rate_limit", "rate_period")
+}
+
+// SetConcurrencyLimit limits how many tasks of taskType may run at once
+// across every worker sharing the database. A limit of 0 removes the limit.
+// The worker type is created if it does not exist yet.
+func (m *Manager) SetConcurrencyLimit(ctx context.Context, taskType string, limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("taskforge: concurrency limit must not be negative")
+	}
+	return m.setTypeLimits(ctx, model.WorkerType{Name: taskType, MaxConcurrency: limit}, "max_concurrency")
+}
+
+// setTypeLimits upserts wt by name, updating only the given columns.
+func (m *Manager) setTypeLimits(ctx context.Context, wt model.WorkerType, columns ...string) error {
+	if wt.Name == "" {
+		return fmt.Errorf("taskforge: task type required")
+	}
+	return m.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns(append(columns, "updated_at")),
+	}).Create(&wt).Error
+}
+
+// runningStatuses are the statuses of tasks that occupy a worker. Tasks
+// awaiting or failing cancellation may still be running.
+func runningStatuses() []string {
+	return []string{string(StatusInProgress), string(StatusPendingCancel), string(StatusFailedToCancel)}
+}
+
+// typeLimit is the rate and concurrency limit of a task type, with how many
+// more of its tasks may start now.
+type typeLimit struct {
+	rate        int
+	period      time.Duration
+	concurrency int
+	started     int // tasks started within the rate period
+	running     int // tasks currently running
+	remaining   int
+}
+
+// loadLimit counts the recent and running tasks of wt's type and computes the
+// type's remaining budget.
+func loadLimit(db *gorm.DB, wt model.WorkerType, now time.Time) (*typeLimit, error) {
+	tl := &typeLimit{rate: wt.RateLimit, period: wt.RatePeriod, concurrency: wt.MaxConcurrency, remaining: -1}
+	if tl.period <= 0 {
+		tl.period = DefaultRatePeriod
+	}
+	if tl.rate > 0 {
+		var started int64
+		if err := db.Model(&model.TaskStart{}).
+			Where("type = ? AND started_at >= ?", wt.Name, now.Add(-tl.period)).
+			Count(&started).Error; err != nil {
+			return nil, err
+		}
+		tl.started = int(started)
+		tl.remaining = max(tl.rate-tl.started, 0)
+	}
+	if tl.concurrency > 0 {
+		var running int64
+		if err := db.Model(&model.Task{}).
+			Where("type = ? AND status IN ?", wt.Name, runningStatuses()).
+			Count(&running).Error; err != nil {
+			return nil, err
+		}
+		tl.running = int(running)
+		free := max(tl.concurrency-tl.running, 0)
+		if tl.remaining < 0 || free < tl.remaining {
+			tl.remaining = free
+		}
+	}
+	return tl, nil
+}
+
+// typeLimits returns the limit of every rate- or concurrency-limited type that
+// opts may claim. With lock set the worker type rows are locked, which
+// serialises reservations of the same type across replicas on databases with
+// row locks.
+func (m *Manager) typeLimits(db *gorm.DB, opts ReserveOptions, now time.Time, lock bool) (map[string]*typeLimit, error) {
+	q := db.Model(&model.WorkerType{}).Where("rate_limit > 0 OR max_concurrency > 0")
+	if len(opts.Types) > 0 {
+		q = q.Where("name IN ?", opts.Types)
+	}
+	if lock {
+		q = q.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	var types []model.WorkerType
+	if err := q.Order("name").Find(&types).Error; err != nil {
+		return nil, err
+	}
+
+	limits := make(map[string]*typeLimit, len(types))
+	for _, wt := range types {
+		tl, err := loadLimit(db, wt, now)
+		if err != nil {
+			return nil, err
+		}
+		limits[wt.Name] = tl
+	}
+	return limits, nil
+}
+
+// exhausted lists the types in limits with no budget left.
+func exhausted(limits map[string]*typeLimit) []string {
+	var types []string
+	for name, tl := range limits {
+		if tl.remaining == 0 {
+			types = append(types, name)
+		}
+	}
+	return types
+}
+
+// take consumes one unit of the budget of t's type and reports whether one
+// was left. Types without a limit always have budget.
+func take(limits map[string]*typeLimit, t *model.Task) bool {
+	tl, ok := limits[t.Type]
+	if !ok {
+		return true
+	}
+	if tl.remaining == 0 {
+		return false
+	}
+	tl.remaining--
+	return true
+}
+
+// startLimited marks a pending task of a limited type as started, as the
+// first statement of its claim, provided its type is still within its limits.
+// The check and the write are a single statement, so concurrent claims cannot
+// both take the last unit.
+func (m *Manager) startLimited(tx *gorm.DB, id uuid.UUID, taskType string, tl *typeLimit, now time.Time) (bool, error) {
+	q := tx.Model(&model.Task{}).Where("id = ? AND status = ?", id, string(StatusPending))
+	if tl.rate > 0 {
+		q = q.Where("(SELECT COUNT(*) FROM task_starts AS r WHERE r.type = ? AND r.started_at >= ?) < ?", taskType, now.Add(-tl.period), tl.rate)
+	}
+	if tl.concurrency > 0 {
+		q = q.Where("(SELECT COUNT(*) FROM tasks AS c WHERE c.type = ? AND c.status IN ?) < ?", taskType, runningStatuses(), tl.concurrency)
+	}
+	res := q.Update("started_at", now)
+	return res.RowsAffected > 0, res.Error
+}
+
+// recordStarts logs the start of each rate-limited task in tasks for the rate
+// limits to count, and drops starts of those types that have left their rate
+// period.
+func recordStarts(tx *gorm.DB, limits map[string]*typeLimit, tasks []model.Task, now time.Time) error {
+	pruned := make(map[string]bool)
+	for i := range tasks {
+		tl, ok := limits[tasks[i].Type]
+		if !ok || tl.rate <= 0 {
+			continue
+		}
+		if !pruned[tasks[i].Type] {
+			if err := tx.Unscoped().
+				Where("type = ? AND started_at < ?", tasks[i].Type, now.Add(-tl.period)).
+				Delete(&model.TaskStart{}).Error; err != nil {
+				return err
+			}
+			pruned[tasks[i].Type] = true
+		}
+		start := model.TaskStart{TaskID: tasks[i].FriendlyID, Type: tasks[i].Type, StartedAt: now}
+		if err := tx.Create(&start).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
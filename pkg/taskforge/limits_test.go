@@ -0,0 +1,174 @@
+package taskforge
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestReserveHonoursRateLimits(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+	if err := mgr.SetRateLimit(ctx, "partner-call", 2, time.Hour); err != nil {
+		t.Fatalf("set rate limit failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := mgr.Enqueue(ctx, &model.Task{Type: "partner-call", Priority: 10}); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+	other := &model.Task{Type: "local"}
+	if err := mgr.Enqueue(ctx, other); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	tasks, err := mgr.ReserveN(ctx, 10, ReserveOptions{})
+	if err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	counts := map[string]int{}
+	for _, task := range tasks {
+		counts[task.Type]++
+	}
+	if counts["partner-call"] != 2 || counts["local"] != 1 {
+		t.Fatalf("expected 2 rate-limited tasks and the other type, got %v", counts)
+	}
+	if _, err := mgr.Reserve(ctx); err == nil {
+		t.Fatalf("expected the rate-limited type to be skipped")
+	}
+
+	// Once the window has passed the type may start tasks again.
+	if err := db.Model(&model.TaskStart{}).Where("type = ?", "partner-call").
+		UpdateColumn("started_at", time.Now().UTC().Add(-2*time.Hour)).Error; err != nil {
+		t.Fatalf("failed to age tasks: %v", err)
+	}
+	got, err := mgr.Reserve(ctx)
+	if err != nil || got.Type != "partner-call" {
+		t.Fatalf("expected the last rate-limited task, got %v (%v)", got, err)
+	}
+
+	if err := mgr.SetRateLimit(ctx, "partner-call", 0, 0); err != nil {
+		t.Fatalf("failed to remove rate limit: %v", err)
+	}
+	var wt model.WorkerType
+	if err := db.Where("name = ?", "partner-call").Take(&wt).Error; err != nil || wt.RateLimit != 0 {
+		t.Fatalf("expected the limit to be removed, got %d (%v)", wt.RateLimit, err)
+	}
+}
+
+func TestRateLimitCountsReleasedStarts(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+	if err := mgr.SetRateLimit(ctx, "partner-call", 1, time.Hour); err != nil {
+		t.Fatalf("set rate limit failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := mgr.Enqueue(ctx, &model.Task{Type: "partner-call"}); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+
+	first, err := mgr.Reserve(ctx)
+	if err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if err := mgr.Release(ctx, first.ID); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	if got, err := mgr.Reserve(ctx); err == nil {
+		t.Fatalf("expected the released start to still count, reserved %s", got.ID)
+	}
+}
+
+func TestRateLimitHoldsUnderConcurrentReservations(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+	if err := mgr.SetRateLimit(ctx, "partner-call", 3, time.Hour); err != nil {
+		t.Fatalf("set rate limit failed: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := mgr.Enqueue(ctx, &model.Task{Type: "partner-call"}); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	claimed := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tasks, err := mgr.ReserveN(ctx, 5, ReserveOptions{Types: []string{"partner-call"}})
+			if err != nil {
+				t.Errorf("reserve failed: %v", err)
+				return
+			}
+			mu.Lock()
+			claimed += len(tasks)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if claimed != 3 {
+		t.Fatalf("expected the rate limit to cap reservations at 3, got %d", claimed)
+	}
+}
+
+func TestReserveHonoursConcurrencyLimits(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+	if err := mgr.SetConcurrencyLimit(ctx, "reindex", 2); err != nil {
+		t.Fatalf("set concurrency limit failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := mgr.Enqueue(ctx, &model.Task{Type: "reindex"}); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+	if err := mgr.Enqueue(ctx, &model.Task{Type: "email"}); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	tasks, err := mgr.ReserveN(ctx, 10, ReserveOptions{})
+	if err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if len(tasks) != 3 {
+		t.Fatalf("expected 2 reindex tasks and the email, got %d tasks", len(tasks))
+	}
+
+	stats, err := mgr.Stats(ctx)
+	if err != nil {
+		t.Fatalf("stats failed: %v", err)
+	}
+	if len(stats) != 2 || stats[1].Type != "reindex" {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if s := stats[1]; s.Pending != 1 || s.Running != 2 || s.MaxConcurrency != 2 || !s.Throttled {
+		t.Fatalf("expected reindex to be throttled at its limit, got %+v", s)
+	}
+	if s := stats[0]; s.Type != "email" || s.Running != 1 || s.Throttled {
+		t.Fatalf("unexpected email stats: %+v", s)
+	}
+
+	// Finishing a running task frees a slot.
+	var finished model.Task
+	for _, task := range tasks {
+		if task.Type == "reindex" {
+			finished = task
+			break
+		}
+	}
+	if err := mgr.Complete(ctx, finished.ID, true); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	got, err := mgr.Reserve(ctx)
+	if err != nil || got.Type != "reindex" {
+		t.Fatalf("expected the last reindex task once a slot freed up, got %v (%v)", got, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,8 +23,18 @@ type Manager struct {
 	table   string
 	retry   RetryPolicy
 	cleanup time.Duration
+	keep    time.Duration
+	aging   time.Duration
+	lease   time.Duration
+	reap    time.Duration
+	cancel  time.Duration
+	dedupe  time.Duration
 	logger  Logger
 	ctx     context.Context
+	inTx    bool // db is a caller's transaction; see WithTx
+
+	mu      sync.Mutex
+	started bool
 }
 
 // NewManager creates a new Manager. Note: caller is responsible for running migrations
@@ -33,98 +44,165 @@ func NewManager(cfg Config) (*Manager, error) {
 		return nil, errors.New("taskforge: DB is required")
 	}
 
+	aging := cfg.PriorityAging
+	if aging == 0 {
+		aging = DefaultPriorityAging
+	}
+	lease := cfg.LeaseDuration
+	if lease <= 0 {
+		lease = DefaultLeaseDuration
+	}
+	reap := cfg.ReapInterval
+	if reap <= 0 {
+		reap = DefaultReapInterval
+	}
+	cancel := cfg.CancelTimeout
+	if cancel <= 0 {
+		cancel = DefaultCancelTimeout
+	}
+	dedupe := cfg.IdempotencyWindow
+	if dedupe <= 0 {
+		dedupe = DefaultIdempotencyWindow
+	}
+	keep := cfg.Retention
+	if keep == 0 {
+		keep = DefaultRetention
+	}
+
 	return &Manager{
 		cfg:     cfg,
 		db:      cfg.DB,
 		table:   cfg.TableName,
 		retry:   cfg.Retry,
 		cleanup: cfg.CleanupInterval,
+		keep:    keep,
+		aging:   aging,
+		lease:   lease,
+		reap:    reap,
+		cancel:  cancel,
+		dedupe:  dedupe,
 		logger:  cfg.Logger,
 		ctx:     cfg.Context,
 	}, nil
 }
 
-// Enqueue inserts a new Task with StatusPending.
+// dbNow returns the current time on GORM's clock, which stamps created_at and
+// updated_at. Values compared with those columns must come from it: SQLite
+// compares times as text, so a UTC value against timestamps in the host's
+// zone is wrong on hosts that are not on UTC.
+func (m *Manager) dbNow() time.Time {
+	return m.db.NowFunc()
+}
+
+// Enqueue inserts a new Task with StatusPending. If t.IdempotencyKey repeats
+// the key of a task of the same type created within Config.IdempotencyWindow,
+// t is filled with that task instead of inserting a duplicate.
 func (m *Manager) Enqueue(ctx context.Context, t *model.Task) error {
 	t.Status = string(StatusPending)
 	if m.logger != nil {
 		m.logger.Infof("Enqueue task with ID=%s", t.ID)
 	}
-	return m.db.WithContext(ctx).Create(t).Error
+	return m.create(ctx, t)
 }
 
-// Reserve locks & returns the next pending task, marking it in-progress.
-func (m *Manager) Reserve(ctx context.Context) (*model.Task, error) {
-	var t model.Task
+// EnqueueAt inserts a new pending Task that will not be reserved before runAt.
+func (m *Manager) EnqueueAt(ctx context.Context, t *model.Task, runAt time.Time) error {
+	runAt = runAt.UTC()
+	t.ScheduledFor = &runAt
+	return m.Enqueue(ctx, t)
+}
 
-	err := m.db.WithContext(ctx).
-		Clauses(clause.Locking{Strength: "UPDATE"}).
-		Where("status = ?", string(StatusPending)).
-		Order("id").
-		First(&t).
-		Error
-	if err != nil {
-		return nil, err
-	}
+// EnqueueIn inserts a new pending Task that will not be reserved until delay has elapsed.
+func (m *Manager) EnqueueIn(ctx context.Context, t *model.Task, delay time.Duration) error {
+	return m.EnqueueAt(ctx, t, time.Now().Add(delay))
+}
 
-	t.Status = string(StatusInProgress)
-	if m.logger != nil {
-		m.logger.Infof("Reserving task ID=%s", t.ID)
+// SetPriority changes the priority of a task that is still pending.
+func (m *Manager) SetPriority(ctx context.Context, id uuid.UUID, priority int) error {
+	res := m.db.WithContext(ctx).
+		Model(&model.Task{}).
+		Where("id = ? AND status = ?", id, string(StatusPending)).
+		Update("priority", priority)
+	if res.Error != nil {
+		return res.Error
 	}
-	if err := m.db.WithContext(ctx).Save(&t).Error; err != nil {
-		return nil, fmt.Errorf("taskforge: reserve failed: %w", err)
+	if res.RowsAffected == 0 {
+		if _, err := m.GetTask(ctx, id); err != nil {
+			return err
+		}
+		return ErrTaskNotPending
 	}
-	return &t, nil
+	return nil
 }
 
-// UpdateStatus sets a Task's status to any valid value.
+// UpdateStatus moves a Task to a new status. It returns ErrInvalidStatus for
+// statuses outside the lifecycle and ErrInvalidTransition when the lifecycle
+// does not allow the change from the task's current status. Tasks start only
+// through Reserve, which grants their lease, so moving a task to in_progress is
+// rejected as well. A task with a child policy that is moved to succeeded
+// waits on its children instead, and a task moved to failed is retried or
+// dead-lettered as by Fail.
 func (m *Manager) UpdateStatus(ctx context.Context, id uuid.UUID, s Status) error {
+	if !s.IsValid() {
+		return fmt.Errorf("%w: %q", ErrInvalidStatus, s)
+	}
 	if m.logger != nil {
 		m.logger.Infof("Updating task ID=%s to status=%s", id, s)
 	}
-	return m.db.WithContext(ctx).
-		Model(&model.Task{}).
-		Where("id = ?", id).
-		Update("status", string(s)).
-		Error
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var t model.Task
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&t, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if s == StatusInProgress {
+			return fmt.Errorf("%w: %s -> %s, tasks start through Reserve", ErrInvalidTransition, t.Status, s)
+		}
+		if s == StatusSucceeded {
+			ok, err := m.succeed(ctx, tx, &t)
+			if err == nil && !ok {
+				err = ErrConcurrentUpdate
+			}
+			return err
+		}
+		if s == StatusFailed {
+			return m.fail(ctx, tx, &t, "")
+		}
+		ok, err := m.setStatus(ctx, tx, &t, s, "", nil)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrConcurrentUpdate
+		}
+		if s.IsTerminal() {
+			return m.finished(ctx, tx, &t)
+		}
+		return nil
+	})
 }
 
-// Complete marks a Task as complete or failed.
+// Complete marks a Task as complete or failed. A failed task whose retry policy
+// allows another attempt gets a retry task scheduled with exponential backoff;
+// use Fail to record why it failed.
 func (m *Manager) Complete(ctx context.Context, id uuid.UUID, success bool) error {
-	newStatus := StatusFailed
 	if success {
-		newStatus = StatusSucceeded
+		return m.UpdateStatus(ctx, id, StatusSucceeded)
 	}
-	return m.UpdateStatus(ctx, id, newStatus)
-}
-
-// CancelTask attempts to cancel a task that is pending or in progress.
-func (m *Manager) CancelTask(ctx context.Context, id uuid.UUID) error {
-	return m.db.WithContext(ctx).
-		Model(&model.Task{}).
-		Where("id = ? AND status IN ?", id, []string{string(StatusPending), string(StatusInProgress)}).
-		Updates(map[string]interface{}{"status": string(StatusPendingCancel)}).
-		Error
+	return m.Fail(ctx, id, "")
 }
 
-// RetryTask clones a failed task into a new retry task.
+// RetryTask clones a failed task into a new retry task. It returns
+// ErrAlreadyRetried if the task already has a retry.
 func (m *Manager) RetryTask(ctx context.Context, id uuid.UUID) (*model.Task, error) {
 	var t model.Task
 	if err := m.db.WithContext(ctx).First(&t, "id = ? AND status = ?", id, string(StatusFailed)).Error; err != nil {
 		return nil, err
 	}
 
-	newTask := t
-	newTask.ID = uuid.Nil
-	newTask.FriendlyID = 0
-	newTask.CreatedAt = time.Time{}
-	newTask.UpdatedAt = time.Time{}
-	newTask.DeletedAt = gorm.DeletedAt{}
-	newTask.Status = string(StatusPending)
-	newTask.ParentTaskID = &t.ID
-	newTask.Attempt = t.Attempt + 1
-
-	if err := m.db.WithContext(ctx).Create(&newTask).Error; err != nil {
+	newTask := newRetryTask(t)
+	if err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return m.scheduleRetry(ctx, tx, &t, &newTask, retryMessage(t))
+	}); err != nil {
 		return nil, err
 	}
 	return &newTask, nil
@@ -157,23 +235,27 @@ func (m *Manager) List(ctx context.Context, filter map[string]interface{}, limit
 
 // --- Basic CRUD operations ---
 
-// CreateTask stores a new task record.
+// CreateTask stores a new task record. Idempotency keys are honoured as in Enqueue.
 func (m *Manager) CreateTask(ctx context.Context, t *model.Task) error {
 	if t.Type == "" {
 		return fmt.Errorf("taskforge: task type required")
 	}
-	return m.cfg.DB.WithContext(ctx).Create(t).Error
+	return m.create(ctx, t)
 }
 
 // CreateTaskFromTemplate creates a new task instance from a stored template.
+// The task inherits the template's priority and execution timeout, and
+// expires if it has not started within the template's ExpirationTime of
+// becoming due. Its worker type's uniqueness settings apply as in Enqueue, so
+// with the coalesce policy the active task may be returned instead.
 func (m *Manager) CreateTaskFromTemplate(ctx context.Context, templateID uuid.UUID, overrides map[string]interface{}, scheduledFor *time.Time) (*model.Task, error) {
 	var tpl model.TaskTemplate
-	if err := m.cfg.DB.WithContext(ctx).First(&tpl, "id = ?", templateID).Error; err != nil {
+	if err := m.db.WithContext(ctx).First(&tpl, "id = ?", templateID).Error; err != nil {
 		return nil, fmt.Errorf("taskforge: failed to load template %s: %w", templateID, err)
 	}
 
 	var worker model.WorkerType
-	if err := m.cfg.DB.WithContext(ctx).First(&worker, "id = ?", tpl.WorkerTypeID).Error; err != nil {
+	if err := m.db.WithContext(ctx).First(&worker, "id = ?", tpl.WorkerTypeID).Error; err != nil {
 		return nil, fmt.Errorf("taskforge: failed to load worker type %s: %w", tpl.WorkerTypeID, err)
 	}
 
@@ -200,13 +282,22 @@ func (m *Manager) CreateTaskFromTemplate(ctx context.Context, templateID uuid.UU
 		Payload:      string(payloadBytes),
 		TemplateID:   &tplID,
 		ScheduledFor: scheduledFor,
-	}
-
-	if err := m.cfg.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(task).Error; err != nil {
-			return err
+		Priority:     tpl.Priority,
+		Timeout:      tpl.Timeout,
+	}
+	if tpl.ExpirationTime > 0 {
+		// The expiry counts from when the task becomes due.
+		expires := time.Now().UTC()
+		if scheduledFor != nil {
+			expires = scheduledFor.UTC()
 		}
+		expires = expires.Add(tpl.ExpirationTime)
+		task.ExpiresAt = &expires
+	}
 
+	// The inputs are stored with the task, which is subject to its worker
+	// type's uniqueness settings like any other enqueue.
+	storeInputs := func(tx *gorm.DB) error {
 		if len(merged) == 0 {
 			return nil
 		}
@@ -223,13 +314,9 @@ func (m *Manager) CreateTaskFromTemplate(ctx context.Context, templateID uuid.UU
 				InputValue: string(valueBytes),
 			})
 		}
-		if len(inputs) > 0 {
-			if err := tx.Create(&inputs).Error; err != nil {
-				return err
-			}
-		}
-		return nil
-	}); err != nil {
+		return tx.Create(&inputs).Error
+	}
+	if err := m.createWith(ctx, task, storeInputs); err != nil {
 		return nil, err
 	}
 
@@ -239,7 +326,7 @@ func (m *Manager) CreateTaskFromTemplate(ctx context.Context, templateID uuid.UU
 // GetTasks retrieves all tasks.
 func (m *Manager) GetTasks(ctx context.Context) ([]model.Task, error) {
 	var tasks []model.Task
-	if err := m.cfg.DB.WithContext(ctx).Find(&tasks).Error; err != nil {
+	if err := m.db.WithContext(ctx).Find(&tasks).Error; err != nil {
 		return nil, err
 	}
 	return tasks, nil
@@ -248,34 +335,47 @@ func (m *Manager) GetTasks(ctx context.Context) ([]model.Task, error) {
 // GetTask fetches a task by its ID.
 func (m *Manager) GetTask(ctx context.Context, id uuid.UUID) (*model.Task, error) {
 	var t model.Task
-	if err := m.cfg.DB.WithContext(ctx).First(&t, "id = ?", id).Error; err != nil {
+	if err := m.db.WithContext(ctx).First(&t, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return &t, nil
 }
 
-// UpdateTask persists changes to an existing task.
+// UpdateTask persists changes to an existing task. Its status is left alone:
+// a different status returns ErrStatusChange, as status changes must go
+// through UpdateStatus to follow the lifecycle and be recorded in the history.
 func (m *Manager) UpdateTask(ctx context.Context, t *model.Task) error {
 	if t.ID == uuid.Nil {
 		return fmt.Errorf("taskforge: missing task ID")
 	}
-	return m.cfg.DB.WithContext(ctx).Save(t).Error
+	db := m.db.WithContext(ctx)
+	var current model.Task
+	if err := db.Select("status").Take(&current, "id = ?", t.ID).Error; err != nil {
+		return err
+	}
+	if t.Status == "" {
+		t.Status = current.Status
+	}
+	if t.Status != current.Status {
+		return fmt.Errorf("%w: task %s is %s", ErrStatusChange, t.ID, current.Status)
+	}
+	return db.Omit("status").Save(t).Error
 }
 
 // DeleteTask removes a task by ID.
 func (m *Manager) DeleteTask(ctx context.Context, id uuid.UUID) error {
-	return m.cfg.DB.WithContext(ctx).Delete(&model.Task{}, "id = ?", id).Error
+	return m.db.WithContext(ctx).Delete(&model.Task{}, "id = ?", id).Error
 }
 
 // CreateTaskTemplate stores a new task template.
 func (m *Manager) CreateTaskTemplate(ctx context.Context, t *model.TaskTemplate) error {
-	return m.cfg.DB.WithContext(ctx).Create(t).Error
+	return m.db.WithContext(ctx).Create(t).Error
 }
 
 // GetTaskTemplates retrieves all task templates.
 func (m *Manager) GetTaskTemplates(ctx context.Context) ([]model.TaskTemplate, error) {
 	var tpls []model.TaskTemplate
-	if err := m.cfg.DB.WithContext(ctx).Find(&tpls).Error; err != nil {
+	if err := m.db.WithContext(ctx).Find(&tpls).Error; err != nil {
 		return nil, err
 	}
 	return tpls, nil
@@ -284,7 +384,7 @@ func (m *Manager) GetTaskTemplates(ctx context.Context) ([]model.TaskTemplate, e
 // GetTaskTemplate fetches a task template by ID.
 func (m *Manager) GetTaskTemplate(ctx context.Context, id uuid.UUID) (*model.TaskTemplate, error) {
 	var tpl model.TaskTemplate
-	if err := m.cfg.DB.WithContext(ctx).First(&tpl, "id = ?", id).Error; err != nil {
+	if err := m.db.WithContext(ctx).First(&tpl, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
 	return &tpl, nil
@@ -295,38 +395,38 @@ func (m *Manager) UpdateTaskTemplate(ctx context.Context, t *model.TaskTemplate)
 	if t.ID == uuid.Nil {
 		return fmt.Errorf("taskforge: missing template ID")
 	}
-	return m.cfg.DB.WithContext(ctx).Save(t).Error
+	return m.db.WithContext(ctx).Save(t).Error
 }
 
 // DeleteTaskTemplate removes a template by ID.
 func (m *Manager) DeleteTaskTemplate(ctx context.Context, id uuid.UUID) error {
-	return m.cfg.DB.WithContext(ctx).Delete(&model.TaskTemplate{}, "id = ?", id).Error
+	return m.db.WithContext(ctx).Delete(&model.TaskTemplate{}, "id = ?", id).Error
 }
 
 // RegisterWorker persists a worker registration.
 func (m *Manager) RegisterWorker(ctx context.Context, w *model.WorkerRegistration) error {
-	return m.cfg.DB.WithContext(ctx).Create(w).Error
+	return m.db.WithContext(ctx).Create(w).Error
 }
 
 // Heartbeat updates a worker heartbeat record.
 func (m *Manager) Heartbeat(ctx context.Context, workerID uuid.UUID) error {
 	var beat model.WorkerHeartbeat
-	if err := m.cfg.DB.WithContext(ctx).First(&beat, "worker_id = ?", workerID).Error; err != nil {
+	if err := m.db.WithContext(ctx).First(&beat, "worker_id = ?", workerID).Error; err != nil {
 		return err
 	}
 	beat.LastPing = time.Now()
-	return m.cfg.DB.WithContext(ctx).Save(&beat).Error
+	return m.db.WithContext(ctx).Save(&beat).Error
 }
 
 // EnqueueJob adds a job to the worker queue.
 func (m *Manager) EnqueueJob(ctx context.Context, j *model.JobQueue) error {
-	return m.cfg.DB.WithContext(ctx).Create(j).Error
+	return m.db.WithContext(ctx).Create(j).Error
 }
 
 // GetQueue returns all queued jobs.
 func (m *Manager) GetQueue(ctx context.Context) ([]model.JobQueue, error) {
 	var q []model.JobQueue
-	if err := m.cfg.DB.WithContext(ctx).Find(&q).Error; err != nil {
+	if err := m.db.WithContext(ctx).Find(&q).Error; err != nil {
 		return nil, err
 	}
 	return q, nil
@@ -334,7 +434,7 @@ func (m *Manager) GetQueue(ctx context.Context) ([]model.JobQueue, error) {
 
 // DequeueJob removes a job from the queue by ID.
 func (m *Manager) DequeueJob(ctx context.Context, id uuid.UUID) error {
-	return m.cfg.DB.WithContext(ctx).Delete(&model.JobQueue{}, "id = ?", id).Error
+	return m.db.WithContext(ctx).Delete(&model.JobQueue{}, "id = ?", id).Error
 }
 
 // --- Child Task Operations ---
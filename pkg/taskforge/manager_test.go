@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -117,6 +118,7 @@ func TestCreateTaskFromTemplate(t *testing.T) {
 		WorkerTypeID:   worker.ID,
 		IsRecurring:    false,
 		ExpirationTime: time.Hour,
+		Timeout:        2 * time.Minute,
 		DefaultInputs:  string(defaultBytes),
 	}
 	if err := db.WithContext(ctx).Create(&tmpl).Error; err != nil {
@@ -182,6 +184,12 @@ func TestCreateTaskFromTemplate(t *testing.T) {
 	if stored.Status != string(StatusPending) {
 		t.Fatalf("expected stored task status %q, got %q", StatusPending, stored.Status)
 	}
+	if stored.Timeout != 2*time.Minute {
+		t.Fatalf("expected stored timeout of 2m, got %s", stored.Timeout)
+	}
+	if stored.ExpiresAt == nil || !stored.ExpiresAt.Equal(scheduledFor.Add(time.Hour)) {
+		t.Fatalf("expected stored expiry %s, got %v", scheduledFor.Add(time.Hour), stored.ExpiresAt)
+	}
 
 	var inputs []model.TaskInput
 	if err := db.WithContext(ctx).Where("task_id = ?", task.FriendlyID).Find(&inputs).Error; err != nil {
@@ -499,3 +507,33 @@ func TestGetTaskTree(t *testing.T) {
 		t.Fatalf("expected child2 to have 0 children, got %d", len(child2Node.Children))
 	}
 }
+
+// newTestManager returns a Manager backed by a SQLite database private to the test.
+func newTestManager(t *testing.T, cfg Config) (*Manager, *gorm.DB) {
+	t.Helper()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "taskforge.db") + "?_busy_timeout=5000&_journal_mode=WAL"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := persistence.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	cfg.DB = db
+	if cfg.Context == nil {
+		cfg.Context = context.Background()
+	}
+	mgr, err := NewManager(cfg)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	return mgr, db
+}
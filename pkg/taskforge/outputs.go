@@ -0,0 +1,96 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// SetOutput stores a named output value on a task, replacing any previous
+// value for the same key.
+func (m *Manager) SetOutput(ctx context.Context, taskID uuid.UUID, key, value string) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var t model.Task
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&t, "id = ?", taskID).Error; err != nil {
+			return err
+		}
+		return m.setOutputs(tx, &t, map[string]string{key: value})
+	})
+}
+
+// GetOutputs returns the outputs recorded for a task, keyed by output name.
+func (m *Manager) GetOutputs(ctx context.Context, taskID uuid.UUID) (map[string]string, error) {
+	t, err := m.GetTask(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	var rows []model.TaskOutput
+	if err := m.db.WithContext(ctx).Where("task_id = ?", t.FriendlyID).Order("output_key").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	outputs := make(map[string]string, len(rows))
+	for _, row := range rows {
+		outputs[row.OutputKey] = row.Value
+	}
+	return outputs, nil
+}
+
+// CompleteWithOutputs marks a task as succeeded and stores its outputs in the
+// same transaction, so consumers never see a succeeded task without its results.
+func (m *Manager) CompleteWithOutputs(ctx context.Context, id uuid.UUID, outputs map[string]string) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var t model.Task
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&t, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if err := m.setOutputs(tx, &t, outputs); err != nil {
+			return err
+		}
+		ok, err := m.succeed(ctx, tx, &t)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrConcurrentUpdate
+		}
+		return nil
+	})
+}
+
+// setOutputs upserts outputs for t. Callers hold the task's row lock, which
+// serializes writers of the same task.
+func (m *Manager) setOutputs(tx *gorm.DB, t *model.Task, outputs map[string]string) error {
+	keys := make([]string, 0, len(outputs))
+	for key := range outputs {
+		if key == "" {
+			return errors.New("taskforge: output key must not be empty")
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var existing model.TaskOutput
+		err := tx.Where("task_id = ? AND output_key = ?", t.FriendlyID, key).Take(&existing).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			row := model.TaskOutput{TaskID: t.FriendlyID, OutputKey: key, Value: outputs[key]}
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			if err := tx.Model(&existing).Update("value", outputs[key]).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
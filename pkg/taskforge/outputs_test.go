@@ -0,0 +1,54 @@
+package taskforge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestSetOutputAndCompleteWithOutputs(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	task := &model.Task{Type: "report"}
+	if err := mgr.Enqueue(ctx, task); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if _, err := mgr.Reserve(ctx); err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if err := mgr.SetOutput(ctx, task.ID, "rows", "10"); err != nil {
+		t.Fatalf("set output failed: %v", err)
+	}
+	if err := mgr.SetOutput(ctx, task.ID, "rows", "20"); err != nil {
+		t.Fatalf("overwrite output failed: %v", err)
+	}
+	if err := mgr.SetOutput(ctx, task.ID, "", "x"); err == nil {
+		t.Fatalf("expected an empty key to be rejected")
+	}
+
+	if err := mgr.CompleteWithOutputs(ctx, task.ID, map[string]string{"url": "s3://bucket/report.csv"}); err != nil {
+		t.Fatalf("complete with outputs failed: %v", err)
+	}
+
+	outputs, err := mgr.GetOutputs(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("get outputs failed: %v", err)
+	}
+	if len(outputs) != 2 || outputs["rows"] != "20" || outputs["url"] != "s3://bucket/report.csv" {
+		t.Fatalf("unexpected outputs: %v", outputs)
+	}
+	stored, err := mgr.GetTask(ctx, task.ID)
+	if err != nil || stored.Status != string(StatusSucceeded) {
+		t.Fatalf("expected task to be succeeded, got %+v (%v)", stored, err)
+	}
+
+	// Completing again is an invalid transition and must not write outputs.
+	if err := mgr.CompleteWithOutputs(ctx, task.ID, map[string]string{"late": "1"}); err == nil {
+		t.Fatalf("expected completing a succeeded task to fail")
+	}
+	if outputs, _ := mgr.GetOutputs(ctx, task.ID); len(outputs) != 2 {
+		t.Fatalf("expected the failed completion to roll back its outputs, got %v", outputs)
+	}
+}
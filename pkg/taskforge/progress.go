@@ -0,0 +1,75 @@
+package taskforge
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// Progress is a change to a task's item counters.
+type Progress struct {
+	Total    int // added to ItemsTotal
+	Impacted int // added to ItemsImpacted
+	Failed   int // added to ItemsFailed
+}
+
+// ReportProgress atomically adds delta to the item counters of a running task.
+// Only the counters are written, so concurrent reports and other updates to
+// the task are never lost. It returns ErrTaskNotInProgress if the task is not
+// running.
+func (m *Manager) ReportProgress(ctx context.Context, id uuid.UUID, delta Progress) error {
+	res := m.db.WithContext(ctx).
+		Model(&model.Task{}).
+		Where("id = ? AND status IN ?", id, []string{string(StatusInProgress), string(StatusPendingCancel)}).
+		Updates(map[string]interface{}{
+			"items_total":    gorm.Expr("items_total + ?", delta.Total),
+			"items_impacted": gorm.Expr("items_impacted + ?", delta.Impacted),
+			"items_failed":   gorm.Expr("items_failed + ?", delta.Failed),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		if _, err := m.GetTask(ctx, id); err != nil {
+			return err
+		}
+		return ErrTaskNotInProgress
+	}
+	return nil
+}
+
+// ProgressEstimate is the progress of a task derived from its item counters.
+// Fields are nil when they cannot be computed.
+type ProgressEstimate struct {
+	PercentComplete *float64   `json:"percent_complete,omitempty"`
+	ETA             *time.Time `json:"eta,omitempty"`
+}
+
+// EstimateProgress computes how far along t is, counting both impacted and
+// failed items as processed. The ETA extrapolates the processing rate since
+// the task started and is only given for running tasks with work left.
+func EstimateProgress(t *model.Task, now time.Time) ProgressEstimate {
+	var est ProgressEstimate
+	if t.ItemsTotal <= 0 {
+		return est
+	}
+	done := t.ItemsImpacted + t.ItemsFailed
+	percent := min(100, float64(done)*100/float64(t.ItemsTotal))
+	est.PercentComplete = &percent
+
+	if Status(t.Status) != StatusInProgress || t.StartedAt == nil || done <= 0 || done >= t.ItemsTotal {
+		return est
+	}
+	elapsed := now.Sub(*t.StartedAt)
+	if elapsed <= 0 {
+		return est
+	}
+	remaining := time.Duration(float64(elapsed) / float64(done) * float64(t.ItemsTotal-done))
+	eta := now.Add(remaining)
+	est.ETA = &eta
+	return est
+}
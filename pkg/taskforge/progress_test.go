@@ -0,0 +1,72 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestReportProgressIncrementsAtomically(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	task := &model.Task{Type: "import"}
+	if err := mgr.Enqueue(ctx, task); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if err := mgr.ReportProgress(ctx, task.ID, Progress{Impacted: 1}); !errors.Is(err, ErrTaskNotInProgress) {
+		t.Fatalf("expected ErrTaskNotInProgress for a pending task, got %v", err)
+	}
+	if _, err := mgr.Reserve(ctx); err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if err := mgr.ReportProgress(ctx, task.ID, Progress{Total: 100}); err != nil {
+		t.Fatalf("report total failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := mgr.ReportProgress(ctx, task.ID, Progress{Impacted: 4, Failed: 1}); err != nil {
+				t.Errorf("report progress failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stored, err := mgr.GetTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("get task failed: %v", err)
+	}
+	if stored.ItemsTotal != 100 || stored.ItemsImpacted != 40 || stored.ItemsFailed != 10 {
+		t.Fatalf("unexpected counters: total=%d impacted=%d failed=%d", stored.ItemsTotal, stored.ItemsImpacted, stored.ItemsFailed)
+	}
+}
+
+func TestEstimateProgress(t *testing.T) {
+	now := time.Now().UTC()
+	started := now.Add(-10 * time.Minute)
+
+	running := &model.Task{Status: string(StatusInProgress), StartedAt: &started, ItemsTotal: 100, ItemsImpacted: 20, ItemsFailed: 5}
+	est := EstimateProgress(running, now)
+	if est.PercentComplete == nil || *est.PercentComplete != 25 {
+		t.Fatalf("expected 25%% complete, got %v", est.PercentComplete)
+	}
+	if est.ETA == nil || !est.ETA.Equal(now.Add(30*time.Minute)) {
+		t.Fatalf("expected an ETA 30 minutes out, got %v", est.ETA)
+	}
+
+	if est := EstimateProgress(&model.Task{Status: string(StatusInProgress)}, now); est.PercentComplete != nil || est.ETA != nil {
+		t.Fatalf("expected no estimate without a total, got %+v", est)
+	}
+	done := &model.Task{Status: string(StatusSucceeded), StartedAt: &started, ItemsTotal: 10, ItemsImpacted: 12}
+	if est := EstimateProgress(done, now); *est.PercentComplete != 100 || est.ETA != nil {
+		t.Fatalf("expected a capped 100%% with no ETA, got %+v", est)
+	}
+}
@@ -0,0 +1,281 @@
+package taskforge
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// ReserveOptions restricts which pending tasks a reservation may claim.
+// Zero-valued fields do not filter.
+type ReserveOptions struct {
+	Types    []string      // only claim tasks of these types
+	Queue    string        // only claim tasks in this named queue
+	Lease    time.Duration // lease to grant claimed tasks (0 = the Manager's lease duration)
+	WorkerID uuid.UUID     // worker recorded on claimed tasks (zero = none)
+}
+
+// Reserve locks & returns the next pending task whose scheduled time has
+// arrived, marking it in-progress. Higher priorities are served first, except
+// that tasks waiting longer than the priority aging threshold go ahead of all
+// others in FIFO order so low-priority work is never starved.
+func (m *Manager) Reserve(ctx context.Context) (*model.Task, error) {
+	return m.ReserveFor(ctx, ReserveOptions{})
+}
+
+// ReserveFor is like Reserve but only claims tasks matching opts, so workers
+// that handle a subset of task types can share one database.
+func (m *Manager) ReserveFor(ctx context.Context, opts ReserveOptions) (*model.Task, error) {
+	tasks, err := m.claim(ctx, opts, 1)
+	if err != nil {
+		return nil, fmt.Errorf("taskforge: reserve failed: %w", err)
+	}
+	if len(tasks) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &tasks[0], nil
+}
+
+// MaxReserveBatch is the largest number of tasks ReserveN claims in one call.
+const MaxReserveBatch = 1000
+
+// ReserveN claims up to n pending tasks matching opts in one round trip and
+// returns them marked in-progress. It returns an empty slice, not an error,
+// when no task is available. n must be between 1 and MaxReserveBatch. Claims
+// may be committed one at a time, so on error the tasks claimed before it are
+// returned as well; the caller owns them and must run or Release them.
+func (m *Manager) ReserveN(ctx context.Context, n int, opts ReserveOptions) ([]model.Task, error) {
+	if n <= 0 || n > MaxReserveBatch {
+		return nil, fmt.Errorf("taskforge: reserve count must be between 1 and %d, got %d", MaxReserveBatch, n)
+	}
+	tasks, err := m.claim(ctx, opts, n)
+	if err != nil {
+		return tasks, fmt.Errorf("taskforge: reserve failed: %w", err)
+	}
+	return tasks, nil
+}
+
+// claim atomically moves up to limit matching pending tasks to in-progress.
+// On Postgres the candidates are locked with FOR UPDATE SKIP LOCKED inside a
+// transaction, so concurrent workers skip each other's rows instead of
+// blocking. Other dialects (SQLite) have no row locks, so each candidate is
+// claimed with a conditional UPDATE that only succeeds while it is still pending.
+func (m *Manager) claim(ctx context.Context, opts ReserveOptions, limit int) ([]model.Task, error) {
+	if m.db.Dialector.Name() == "postgres" {
+		return m.claimLocked(ctx, opts, limit)
+	}
+	return m.claimCAS(ctx, opts, limit)
+}
+
+func (m *Manager) claimLocked(ctx context.Context, opts ReserveOptions, limit int) ([]model.Task, error) {
+	claimed := []model.Task{}
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		limits, err := m.typeLimits(tx, opts, now, true)
+		if err != nil {
+			return err
+		}
+		var found []model.Task
+		if err := m.reservable(tx, opts, now, exhausted(limits)).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Order(m.reserveOrder(now)).
+			Limit(limit).
+			Find(&found).Error; err != nil {
+			return err
+		}
+		candidates := found[:0]
+		for i := range found {
+			if take(limits, &found[i]) {
+				candidates = append(candidates, found[i])
+			}
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(candidates))
+		for i := range candidates {
+			ids[i] = candidates[i].ID
+		}
+		updates := m.claimUpdates(opts, now)
+		updates["status"] = string(StatusInProgress)
+		if err := tx.Model(&model.Task{}).
+			Where("id IN ?", ids).
+			Updates(updates).Error; err != nil {
+			return err
+		}
+		for i := range candidates {
+			if deadline := deadlineFor(&candidates[i], now); deadline != nil {
+				if err := tx.Model(&candidates[i]).UpdateColumn("deadline_at", *deadline).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if err := recordStarts(tx, limits, candidates, now); err != nil {
+			return err
+		}
+		for i := range candidates {
+			m.markClaimed(&candidates[i], opts, now)
+		}
+		if err := m.recordHistory(ctx, tx, candidates, StatusPending, ""); err != nil {
+			return err
+		}
+		claimed = append(claimed, candidates...)
+		return nil
+	})
+	return claimed, err
+}
+
+func (m *Manager) claimCAS(ctx context.Context, opts ReserveOptions, limit int) ([]model.Task, error) {
+	db := m.db.WithContext(ctx)
+	claimed := []model.Task{}
+	for len(claimed) < limit {
+		now := time.Now().UTC()
+		limits, err := m.typeLimits(db, opts, now, false)
+		if err != nil {
+			return claimed, err
+		}
+		var candidates []model.Task
+		if err := m.reservable(db, opts, now, exhausted(limits)).
+			Order(m.reserveOrder(now)).
+			Limit(limit - len(claimed)).
+			Find(&candidates).Error; err != nil {
+			return claimed, err
+		}
+		if len(candidates) == 0 {
+			break
+		}
+
+		// Each claim is a conditional UPDATE plus its history row. Every lost
+		// race means another worker claimed the row, or used up the limits of
+		// its type, so the loop always makes progress.
+		for i := range candidates {
+			if !take(limits, &candidates[i]) {
+				continue
+			}
+			var ok bool
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if tl, limited := limits[candidates[i].Type]; limited {
+					started, err := m.startLimited(tx, candidates[i].ID, candidates[i].Type, tl, now)
+					if !started || err != nil {
+						return err
+					}
+				}
+				updates := m.claimUpdates(opts, now)
+				if deadline := deadlineFor(&candidates[i], now); deadline != nil {
+					updates["deadline_at"] = *deadline
+				}
+				var err error
+				ok, err = m.setStatus(ctx, tx, &candidates[i], StatusInProgress, "", updates)
+				if err != nil || !ok {
+					return err
+				}
+				return recordStarts(tx, limits, candidates[i:i+1], now)
+			})
+			if err != nil {
+				return claimed, err
+			}
+			if ok {
+				m.markClaimed(&candidates[i], opts, now)
+				claimed = append(claimed, candidates[i])
+			}
+		}
+	}
+	return claimed, nil
+}
+
+// claimUpdates are the column changes applied alongside the status change of a
+// claimed task: it records when the task started, which worker claimed it, and
+// receives a lease.
+func (m *Manager) claimUpdates(opts ReserveOptions, now time.Time) map[string]interface{} {
+	updates := map[string]interface{}{
+		"started_at":       now,
+		"lease_expires_at": now.Add(m.leaseFor(opts)),
+		"updated_at":       m.dbNow(),
+	}
+	if opts.WorkerID != uuid.Nil {
+		updates["worker_id"] = opts.WorkerID
+	}
+	return updates
+}
+
+// deadlineFor returns when a run of t started at now times out, or nil if t
+// has no timeout.
+func deadlineFor(t *model.Task, now time.Time) *time.Time {
+	if t.Timeout <= 0 {
+		return nil
+	}
+	deadline := now.Add(t.Timeout)
+	return &deadline
+}
+
+func (m *Manager) leaseFor(opts ReserveOptions) time.Duration {
+	if opts.Lease > 0 {
+		return opts.Lease
+	}
+	return m.lease
+}
+
+// markClaimed mirrors a successful claim onto the in-memory task.
+func (m *Manager) markClaimed(t *model.Task, opts ReserveOptions, now time.Time) {
+	expires := now.Add(m.leaseFor(opts))
+	t.Status = string(StatusInProgress)
+	t.StartedAt = &now
+	t.LeaseExpiresAt = &expires
+	t.DeadlineAt = deadlineFor(t, now)
+	t.UpdatedAt = m.dbNow()
+	if opts.WorkerID != uuid.Nil {
+		workerID := opts.WorkerID
+		t.WorkerID = &workerID
+	}
+	if m.logger != nil {
+		m.logger.Infof("Reserving task ID=%s", t.ID)
+	}
+}
+
+// reservable scopes db to pending tasks that are due and have not expired,
+// whose dependencies have succeeded, and that match opts. Tasks of the skipped
+// types are left for later, so a type over its rate or concurrency limit does
+// not hold up the others.
+func (m *Manager) reservable(db *gorm.DB, opts ReserveOptions, now time.Time, skipped []string) *gorm.DB {
+	db = db.Model(&model.Task{}).
+		Where("status = ?", string(StatusPending)).
+		Where("scheduled_for IS NULL OR scheduled_for <= ?", now).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Where(dependencyFilter, string(StatusSucceeded))
+	if len(opts.Types) > 0 {
+		db = db.Where("type IN ?", opts.Types)
+	}
+	if opts.Queue != "" {
+		db = db.Where("queue = ?", opts.Queue)
+	}
+	if len(skipped) > 0 {
+		db = db.Where("type NOT IN ?", skipped)
+	}
+	return db
+}
+
+// reserveOrder sorts aged tasks first (FIFO), then by descending priority and
+// ID. A task ages from its scheduled time, or from its creation if it has none;
+// created_at is compared on GORM's clock.
+func (m *Manager) reserveOrder(now time.Time) clause.OrderBy {
+	if m.aging < 0 {
+		return clause.OrderBy{Columns: []clause.OrderByColumn{
+			{Column: clause.Column{Name: "priority"}, Desc: true},
+			{Column: clause.Column{Name: "id"}},
+		}}
+	}
+	scheduled, created := now.Add(-m.aging), m.dbNow().Add(-m.aging)
+	return clause.OrderBy{Expression: clause.Expr{
+		SQL: "CASE WHEN COALESCE(scheduled_for <= ?, created_at <= ?) THEN 0 ELSE 1 END, " +
+			"CASE WHEN COALESCE(scheduled_for <= ?, created_at <= ?) THEN 0 ELSE priority END DESC, id",
+		Vars:               []interface{}{scheduled, created, scheduled, created},
+		WithoutParentheses: true,
+	}}
+}
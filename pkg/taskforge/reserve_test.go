@@ -0,0 +1,326 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestReserveSkipsFutureTasks(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	future := &model.Task{Type: "report"}
+	if err := mgr.EnqueueIn(ctx, future, time.Hour); err != nil {
+		t.Fatalf("enqueue future task failed: %v", err)
+	}
+	if _, err := mgr.Reserve(ctx); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected no reservable task, got %v", err)
+	}
+
+	due := &model.Task{Type: "report"}
+	if err := mgr.EnqueueAt(ctx, due, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("enqueue due task failed: %v", err)
+	}
+	immediate := &model.Task{Type: "report"}
+	if err := mgr.Enqueue(ctx, immediate); err != nil {
+		t.Fatalf("enqueue immediate task failed: %v", err)
+	}
+
+	reserved := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		got, err := mgr.Reserve(ctx)
+		if err != nil {
+			t.Fatalf("reserve failed: %v", err)
+		}
+		reserved[got.ID.String()] = true
+	}
+	if !reserved[due.ID.String()] || !reserved[immediate.ID.String()] {
+		t.Fatalf("expected due and immediate tasks to be reserved, got %v", reserved)
+	}
+	if reserved[future.ID.String()] {
+		t.Fatalf("future task must not be reserved")
+	}
+	if _, err := mgr.Reserve(ctx); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected future task to stay queued, got %v", err)
+	}
+}
+
+func TestReserveDueTasksScheduledInOtherZones(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	// Ahead of UTC, a local time that has passed still sorts after UTC now
+	// when compared as text.
+	tokyo := time.FixedZone("JST", 9*60*60)
+	due := time.Now().In(tokyo).Add(-time.Minute)
+	single := &model.Task{Type: "report", ScheduledFor: &due}
+	if err := mgr.Enqueue(ctx, single); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	batched := &model.Task{Type: "report", ScheduledFor: &due}
+	if err := mgr.EnqueueBatch(ctx, []*model.Task{batched}); err != nil {
+		t.Fatalf("enqueue batch failed: %v", err)
+	}
+
+	tasks, err := mgr.ReserveN(ctx, 10, ReserveOptions{})
+	if err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("expected both due tasks to be reserved, got %d", len(tasks))
+	}
+}
+
+func TestReserveOrdersByPriorityWithAging(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{PriorityAging: time.Hour})
+
+	old := model.Task{Type: "report", Status: string(StatusPending), Priority: -5}
+	if err := db.Create(&old).Error; err != nil {
+		t.Fatalf("failed to seed task: %v", err)
+	}
+	if err := db.Model(&old).UpdateColumn("created_at", db.NowFunc().Add(-2*time.Hour)).Error; err != nil {
+		t.Fatalf("failed to age task: %v", err)
+	}
+
+	low := &model.Task{Type: "report", Priority: 1}
+	high := &model.Task{Type: "report", Priority: 10}
+	for _, task := range []*model.Task{low, high} {
+		if err := mgr.Enqueue(ctx, task); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+
+	for i, want := range []uuid.UUID{old.ID, high.ID, low.ID} {
+		got, err := mgr.Reserve(ctx)
+		if err != nil {
+			t.Fatalf("reserve %d failed: %v", i, err)
+		}
+		if got.ID != want {
+			t.Fatalf("reserve %d: expected task %s, got %s (priority %d)", i, want, got.ID, got.Priority)
+		}
+	}
+}
+
+func TestSetPriority(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	task := &model.Task{Type: "report"}
+	if err := mgr.Enqueue(ctx, task); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if err := mgr.SetPriority(ctx, task.ID, 7); err != nil {
+		t.Fatalf("set priority failed: %v", err)
+	}
+	stored, err := mgr.GetTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("get task failed: %v", err)
+	}
+	if stored.Priority != 7 {
+		t.Fatalf("expected priority 7, got %d", stored.Priority)
+	}
+
+	if _, err := mgr.Reserve(ctx); err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if err := mgr.SetPriority(ctx, task.ID, 1); !errors.Is(err, ErrTaskNotPending) {
+		t.Fatalf("expected ErrTaskNotPending, got %v", err)
+	}
+	if err := mgr.SetPriority(ctx, uuid.New(), 1); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected gorm.ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestReserveForFiltersByTypeAndQueue(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	email := &model.Task{Type: "send_email"}
+	sms := &model.Task{Type: "send_sms"}
+	bulk := &model.Task{Type: "send_email", Queue: "bulk"}
+	for _, task := range []*model.Task{email, sms, bulk} {
+		if err := mgr.Enqueue(ctx, task); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+
+	got, err := mgr.ReserveFor(ctx, ReserveOptions{Types: []string{"send_sms"}})
+	if err != nil {
+		t.Fatalf("reserve by type failed: %v", err)
+	}
+	if got.ID != sms.ID {
+		t.Fatalf("expected sms task, got %s (%s)", got.ID, got.Type)
+	}
+
+	got, err = mgr.ReserveFor(ctx, ReserveOptions{Queue: "bulk"})
+	if err != nil {
+		t.Fatalf("reserve by queue failed: %v", err)
+	}
+	if got.ID != bulk.ID {
+		t.Fatalf("expected bulk task, got %s", got.ID)
+	}
+
+	if _, err := mgr.ReserveFor(ctx, ReserveOptions{Types: []string{"send_sms"}}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected no more sms tasks, got %v", err)
+	}
+}
+
+func TestReserveNeverHandsOutTaskTwice(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	const taskCount = 60
+	for i := 0; i < taskCount; i++ {
+		if err := mgr.Enqueue(ctx, &model.Task{Type: "contended"}); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+
+	const workers = 8
+	var (
+		mu       sync.Mutex
+		seen     = make(map[uuid.UUID]int)
+		wg       sync.WaitGroup
+		failures = make(chan error, workers)
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				task, err := mgr.Reserve(ctx)
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return
+				}
+				if err != nil {
+					failures <- err
+					return
+				}
+				mu.Lock()
+				seen[task.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	close(failures)
+	for err := range failures {
+		t.Fatalf("reserve failed: %v", err)
+	}
+
+	if len(seen) != taskCount {
+		t.Fatalf("expected %d distinct tasks reserved, got %d", taskCount, len(seen))
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Fatalf("task %s was reserved %d times", id, n)
+		}
+	}
+}
+
+func TestReserveN(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+
+	for i := 0; i < 5; i++ {
+		if err := mgr.Enqueue(ctx, &model.Task{Type: "tiny", Priority: i}); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+
+	batch, err := mgr.ReserveN(ctx, 3, ReserveOptions{})
+	if err != nil {
+		t.Fatalf("reserve batch failed: %v", err)
+	}
+	if len(batch) != 3 {
+		t.Fatalf("expected 3 tasks, got %d", len(batch))
+	}
+	for i, task := range batch {
+		if task.Status != string(StatusInProgress) {
+			t.Fatalf("expected task %d to be in progress, got %q", i, task.Status)
+		}
+		if want := 4 - i; task.Priority != want {
+			t.Fatalf("expected task %d to have priority %d, got %d", i, want, task.Priority)
+		}
+	}
+
+	rest, err := mgr.ReserveN(ctx, 10, ReserveOptions{})
+	if err != nil {
+		t.Fatalf("reserve batch failed: %v", err)
+	}
+	if len(rest) != 2 {
+		t.Fatalf("expected remaining 2 tasks, got %d", len(rest))
+	}
+
+	empty, err := mgr.ReserveN(ctx, 10, ReserveOptions{})
+	if err != nil {
+		t.Fatalf("reserve batch failed: %v", err)
+	}
+	if len(empty) != 0 {
+		t.Fatalf("expected no tasks, got %d", len(empty))
+	}
+
+	var inProgress int64
+	if err := db.Model(&model.Task{}).Where("status = ?", string(StatusInProgress)).Count(&inProgress).Error; err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if inProgress != 5 {
+		t.Fatalf("expected 5 in-progress tasks, got %d", inProgress)
+	}
+
+	if _, err := mgr.ReserveN(ctx, 0, ReserveOptions{}); err == nil {
+		t.Fatalf("expected error for non-positive count")
+	}
+	if _, err := mgr.ReserveN(ctx, MaxReserveBatch+1, ReserveOptions{}); err == nil {
+		t.Fatalf("expected error for a count above MaxReserveBatch")
+	}
+}
+
+func TestReserveNReturnsClaimedTasksOnError(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+
+	for i := 0; i < 3; i++ {
+		if err := mgr.Enqueue(ctx, &model.Task{Type: "tiny"}); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+
+	// Fail the second claim, after the first has been committed.
+	claims := 0
+	injected := errors.New("injected failure")
+	if err := db.Callback().Update().After("gorm:update").Register("test:fail_second_claim", func(tx *gorm.DB) {
+		if tx.Statement.Table == "tasks" {
+			if claims++; claims == 2 {
+				tx.AddError(injected)
+			}
+		}
+	}); err != nil {
+		t.Fatalf("register callback failed: %v", err)
+	}
+
+	batch, err := mgr.ReserveN(ctx, 3, ReserveOptions{})
+	if !errors.Is(err, injected) {
+		t.Fatalf("expected the injected error, got %v", err)
+	}
+	if len(batch) != 1 {
+		t.Fatalf("expected the task claimed before the error, got %d tasks", len(batch))
+	}
+
+	var inProgress []model.Task
+	if err := db.Where("status = ?", string(StatusInProgress)).Find(&inProgress).Error; err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(inProgress) != 1 || inProgress[0].ID != batch[0].ID {
+		t.Fatalf("expected only the returned task to be in progress, got %d tasks", len(inProgress))
+	}
+}
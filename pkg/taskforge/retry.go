@@ -0,0 +1,224 @@
+package taskforge
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// retryPolicyFor resolves the effective retry policy for a task. Non-zero
+// settings on the task's template win over its worker type, which in turn win
+// over the Manager's default policy.
+func (m *Manager) retryPolicyFor(ctx context.Context, db *gorm.DB, t *model.Task) (RetryPolicy, error) {
+	policy := m.retry
+
+	var wt model.WorkerType
+	err := db.WithContext(ctx).Where("name = ?", t.Type).Limit(1).Find(&wt).Error
+	if err != nil {
+		return policy, err
+	}
+	policy = policy.override(wt.MaxAttempts, wt.RetryBackoff)
+
+	if t.TemplateID != nil {
+		var tpl model.TaskTemplate
+		if err := db.WithContext(ctx).Where("id = ?", *t.TemplateID).Limit(1).Find(&tpl).Error; err != nil {
+			return policy, err
+		}
+		policy = policy.override(tpl.MaxAttempts, tpl.RetryBackoff)
+	}
+	return policy, nil
+}
+
+func (p RetryPolicy) override(attempts int, backoff time.Duration) RetryPolicy {
+	if attempts != 0 {
+		p.Attempts = attempts
+	}
+	if backoff != 0 {
+		p.Backoff = backoff
+	}
+	return p
+}
+
+// allowsRetry reports whether a task on the given zero-based attempt may be tried again.
+func (p RetryPolicy) allowsRetry(attempt int) bool {
+	return attempt+1 < p.Attempts
+}
+
+// delay returns the wait before retrying a task that failed on the given
+// zero-based attempt: Backoff doubled per attempt, capped by MaxBackoff, plus jitter.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	if p.Backoff <= 0 {
+		return 0
+	}
+
+	d := p.Backoff
+	for i := 0; i < attempt; i++ {
+		if (p.MaxBackoff > 0 && d >= p.MaxBackoff) || d > math.MaxInt64/2 {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	jitter := p.Jitter
+	if jitter <= 0 {
+		jitter = DefaultRetryJitter
+	}
+	if span := int64(float64(d) * jitter); span > 0 {
+		d += time.Duration(rand.Int63n(span))
+	}
+	return d
+}
+
+// newRetryTask clones a failed task into a fresh pending task for the next attempt.
+func newRetryTask(t model.Task) model.Task {
+	retry := t
+	retry.ID = uuid.Nil
+	retry.FriendlyID = 0
+	retry.CreatedAt = time.Time{}
+	retry.UpdatedAt = time.Time{}
+	retry.DeletedAt = gorm.DeletedAt{}
+	retry.Status = string(StatusPending)
+	retry.ParentTaskID = &t.ID
+	retry.RetryOfID = &t.ID
+	retry.Attempt = t.Attempt + 1
+	retry.ScheduledFor = nil
+	retry.StartedAt = nil
+	retry.LeaseExpiresAt = nil
+	retry.DeadlineAt = nil
+	retry.ExpiresAt = nil
+	retry.WorkerID = nil
+	retry.LastError = ""
+	retry.IdempotencyKey = nil
+	return retry
+}
+
+// Fail marks a task as failed with the given error message. When its retry
+// policy allows another attempt a retry task is scheduled after the policy's
+// backoff; otherwise the task is recorded in the dead letter queue. A task
+// whose cancellation was requested has stopped as asked, so it is cancelled
+// instead and never retried.
+func (m *Manager) Fail(ctx context.Context, id uuid.UUID, errMsg string) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var t model.Task
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&t, "id = ?", id).Error; err != nil {
+			return err
+		}
+		return m.fail(ctx, tx, &t, errMsg)
+	})
+}
+
+// fail applies Fail to t, which is locked inside tx.
+func (m *Manager) fail(ctx context.Context, tx *gorm.DB, t *model.Task, errMsg string) error {
+	if Status(t.Status) == StatusPendingCancel {
+		ok, err := m.setStatus(ctx, tx, t, StatusCancelled, errMsg, map[string]interface{}{"last_error": errMsg})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrConcurrentUpdate
+		}
+		t.LastError = errMsg
+		return m.finished(ctx, tx, t)
+	}
+
+	ok, err := m.setStatus(ctx, tx, t, StatusFailed, errMsg, map[string]interface{}{"last_error": errMsg})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrConcurrentUpdate
+	}
+	t.LastError = errMsg
+
+	policy, err := m.retryPolicyFor(ctx, tx, t)
+	if err != nil {
+		return err
+	}
+	if !policy.allowsRetry(t.Attempt) {
+		return m.deadLetter(ctx, tx, t, errMsg)
+	}
+
+	var existing int64
+	if err := tx.Model(&model.Task{}).Where("retry_of_id = ?", t.ID).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+	if t.UniqueActive {
+		// A newer task for the same reference was enqueued while this one
+		// ran; it supersedes the retry.
+		active, err := m.findActive(tx, t)
+		if err != nil {
+			return err
+		}
+		if active != nil {
+			if err := m.moveDependents(tx, t, active); err != nil {
+				return err
+			}
+			return m.resolveParent(ctx, tx, t)
+		}
+	}
+
+	retry := newRetryTask(*t)
+	runAt := time.Now().UTC().Add(policy.delay(t.Attempt))
+	retry.ScheduledFor = &runAt
+	if m.logger != nil {
+		m.logger.Infof("Scheduling retry %d of task ID=%s at %s", retry.Attempt, t.ID, runAt)
+	}
+	if err := m.scheduleRetry(ctx, tx, t, &retry, retryMessage(*t)); err != nil {
+		return fmt.Errorf("taskforge: failed to schedule retry: %w", err)
+	}
+	return nil
+}
+
+// scheduleRetry inserts retry as the next attempt of failed and records its
+// creation with msg. Every way of retrying a task goes through it, so a task
+// is retried at most once: it returns ErrAlreadyRetried if failed already has
+// a retry. Tasks that depend on failed are moved over to the retry, and its
+// dead letter entry, if any, is marked handled.
+func (m *Manager) scheduleRetry(ctx context.Context, tx *gorm.DB, failed, retry *model.Task, msg string) error {
+	var locked []model.Task
+	if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		Where("id = ?", failed.ID).
+		Find(&locked).Error; err != nil {
+		return err
+	}
+	var existing int64
+	if err := tx.Model(&model.Task{}).Where("retry_of_id = ?", failed.ID).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return fmt.Errorf("%w: task %s", ErrAlreadyRetried, failed.ID)
+	}
+
+	if err := tx.Create(retry).Error; err != nil {
+		return err
+	}
+	if err := m.moveDependents(tx, failed, retry); err != nil {
+		return err
+	}
+	if err := tx.Model(&model.DeadLetterQueue{}).
+		Where("task_id = ? AND handled = ?", failed.FriendlyID, false).
+		Update("handled", true).Error; err != nil {
+		return err
+	}
+	return m.recordHistory(ctx, tx, []model.Task{*retry}, "", msg)
+}
+
+// retryMessage is the history message recorded when a retry task is created.
+func retryMessage(failed model.Task) string {
+	return fmt.Sprintf("retry of task %s", failed.ID)
+}
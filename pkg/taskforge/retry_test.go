@@ -0,0 +1,138 @@
+package taskforge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestCompleteFailureSchedulesRetriesWithBackoff(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{
+		Retry: RetryPolicy{Attempts: 3, Backoff: time.Minute},
+	})
+
+	task := model.Task{Type: "flaky", Status: string(StatusInProgress)}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("failed to seed task: %v", err)
+	}
+
+	current := task
+	for attempt := 1; attempt < 3; attempt++ {
+		before := time.Now().UTC()
+		if err := mgr.Complete(ctx, current.ID, false); err != nil {
+			t.Fatalf("complete failed: %v", err)
+		}
+
+		var retry model.Task
+		if err := db.First(&retry, "retry_of_id = ?", current.ID).Error; err != nil {
+			t.Fatalf("expected retry for attempt %d: %v", attempt, err)
+		}
+		if retry.Attempt != attempt {
+			t.Fatalf("expected attempt %d, got %d", attempt, retry.Attempt)
+		}
+		if retry.Status != string(StatusPending) {
+			t.Fatalf("expected retry to be pending, got %q", retry.Status)
+		}
+
+		minDelay := time.Minute << (attempt - 1)
+		maxDelay := minDelay + time.Duration(float64(minDelay)*DefaultRetryJitter)
+		if retry.ScheduledFor == nil {
+			t.Fatalf("expected retry to be scheduled")
+		}
+		delay := retry.ScheduledFor.Sub(before)
+		if delay < minDelay-time.Second || delay > maxDelay+time.Second {
+			t.Fatalf("attempt %d: expected delay in [%s, %s], got %s", attempt, minDelay, maxDelay, delay)
+		}
+		if err := db.Model(&retry).Update("status", string(StatusInProgress)).Error; err != nil {
+			t.Fatalf("failed to start retry: %v", err)
+		}
+		current = retry
+	}
+
+	if err := mgr.Complete(ctx, current.ID, false); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	var count int64
+	if err := db.Model(&model.Task{}).Where("retry_of_id = ?", current.ID).Count(&count).Error; err != nil {
+		t.Fatalf("failed to count retries: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("expected no retry after attempts are exhausted, got %d", count)
+	}
+}
+
+func TestUpdateStatusFailedSchedulesRetry(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{
+		Retry: RetryPolicy{Attempts: 3, Backoff: time.Minute},
+	})
+
+	task := model.Task{Type: "flaky", Status: string(StatusInProgress)}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("failed to seed task: %v", err)
+	}
+	if err := mgr.UpdateStatus(ctx, task.ID, StatusFailed); err != nil {
+		t.Fatalf("update status failed: %v", err)
+	}
+
+	var retry model.Task
+	if err := db.First(&retry, "retry_of_id = ?", task.ID).Error; err != nil {
+		t.Fatalf("expected a retry: %v", err)
+	}
+	if retry.Attempt != 1 || retry.Status != string(StatusPending) {
+		t.Fatalf("expected a pending retry on attempt 1, got %q on attempt %d", retry.Status, retry.Attempt)
+	}
+}
+
+func TestRetryPolicyOverrides(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{
+		Retry: RetryPolicy{Attempts: 1, Backoff: time.Second},
+	})
+
+	worker := model.WorkerType{Name: "importer", MaxAttempts: 5, RetryBackoff: time.Minute}
+	if err := db.Create(&worker).Error; err != nil {
+		t.Fatalf("failed to seed worker type: %v", err)
+	}
+	tpl := model.TaskTemplate{Name: "import", WorkerTypeID: worker.ID, ExpirationTime: time.Hour, RetryBackoff: time.Hour}
+	if err := db.Create(&tpl).Error; err != nil {
+		t.Fatalf("failed to seed template: %v", err)
+	}
+
+	byType, err := mgr.retryPolicyFor(ctx, db, &model.Task{Type: "importer"})
+	if err != nil {
+		t.Fatalf("resolve policy failed: %v", err)
+	}
+	if byType.Attempts != 5 || byType.Backoff != time.Minute {
+		t.Fatalf("expected worker type override, got %+v", byType)
+	}
+
+	byTemplate, err := mgr.retryPolicyFor(ctx, db, &model.Task{Type: "importer", TemplateID: &tpl.ID})
+	if err != nil {
+		t.Fatalf("resolve policy failed: %v", err)
+	}
+	if byTemplate.Attempts != 5 || byTemplate.Backoff != time.Hour {
+		t.Fatalf("expected template backoff with worker type attempts, got %+v", byTemplate)
+	}
+
+	fallback, err := mgr.retryPolicyFor(ctx, db, &model.Task{Type: "other"})
+	if err != nil {
+		t.Fatalf("resolve policy failed: %v", err)
+	}
+	if fallback.Attempts != 1 || fallback.Backoff != time.Second {
+		t.Fatalf("expected manager default policy, got %+v", fallback)
+	}
+}
+
+func TestRetryPolicyDelayIsCapped(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 10 * time.Second, Jitter: 0.5}
+	for attempt := 0; attempt < 80; attempt++ {
+		d := p.delay(attempt)
+		if d < time.Second || d > 15*time.Second {
+			t.Fatalf("attempt %d: delay %s out of bounds", attempt, d)
+		}
+	}
+}
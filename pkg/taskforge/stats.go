@@ -0,0 +1,83 @@
+package taskforge
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// TypeStats summarises the queue for one task type. Throttled is set when
+// pending tasks of the type are held back because it is at its rate or
+// concurrency limit.
+type TypeStats struct {
+	Type            string        `json:"type"`
+	Pending         int           `json:"pending"`
+	Running         int           `json:"running"`
+	MaxConcurrency  int           `json:"max_concurrency,omitempty"`
+	RateLimit       int           `json:"rate_limit,omitempty"`
+	RatePeriod      time.Duration `json:"rate_period,omitempty"`
+	StartedInPeriod int           `json:"started_in_period,omitempty"`
+	Throttled       bool          `json:"throttled"`
+}
+
+// Stats returns queue statistics for every task type that has pending or
+// running tasks or a configured limit, ordered by type. Running counts tasks
+// in progress, including those whose cancellation is still being resolved.
+func (m *Manager) Stats(ctx context.Context) ([]TypeStats, error) {
+	db := m.db.WithContext(ctx)
+	var rows []struct {
+		Type   string
+		Status string
+		Count  int
+	}
+	if err := db.Model(&model.Task{}).
+		Select("type, status, COUNT(*) AS count").
+		Where("status IN ?", append(runningStatuses(), string(StatusPending))).
+		Group("type, status").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	byType := make(map[string]*TypeStats)
+	get := func(taskType string) *TypeStats {
+		s, ok := byType[taskType]
+		if !ok {
+			s = &TypeStats{Type: taskType}
+			byType[taskType] = s
+		}
+		return s
+	}
+	for _, r := range rows {
+		s := get(r.Type)
+		if Status(r.Status) == StatusPending {
+			s.Pending += r.Count
+		} else {
+			s.Running += r.Count
+		}
+	}
+
+	limits, err := m.typeLimits(db, ReserveOptions{}, time.Now().UTC(), false)
+	if err != nil {
+		return nil, err
+	}
+	for name, tl := range limits {
+		s := get(name)
+		s.MaxConcurrency = tl.concurrency
+		if tl.rate > 0 {
+			s.RateLimit = tl.rate
+			s.RatePeriod = tl.period
+			s.StartedInPeriod = tl.started
+		}
+		s.Throttled = s.Pending > 0 && tl.remaining == 0
+	}
+
+	stats := make([]TypeStats, 0, len(byType))
+	for _, s := range byType {
+		stats = append(stats, *s)
+	}
+	slices.SortFunc(stats, func(a, b TypeStats) int { return strings.Compare(a.Type, b.Type) })
+	return stats, nil
+}
@@ -1,5 +1,7 @@
 package taskforge
 
+import "slices"
+
 // Status is the lifecycle state of a Task in TaskForge.
 type Status string
 
@@ -11,13 +13,58 @@ const (
 	StatusPendingCancel  Status = "pending_cancellation"
 	StatusCancelled      Status = "cancelled"
 	StatusFailedToCancel Status = "failed_to_cancel"
+	StatusWaiting        Status = "waiting_on_children"
+	StatusExpired        Status = "expired"
 )
 
+// transitions lists, for each status, the statuses a task may move to next.
+// Statuses without an entry are terminal. In-progress tasks may return to
+// pending when their lease expires, pending tasks fail when a dependency they
+// require fails and expire when they are not started in time, and tasks
+// awaiting cancellation may still finish if the worker completes before it
+// notices the request. A task that aggregates its children waits for them
+// after its own work is done.
+var transitions = map[Status][]Status{
+	StatusPending:        {StatusInProgress, StatusCancelled, StatusFailed, StatusExpired},
+	StatusInProgress:     {StatusSucceeded, StatusFailed, StatusPending, StatusPendingCancel, StatusWaiting},
+	StatusPendingCancel:  {StatusCancelled, StatusFailedToCancel, StatusSucceeded, StatusFailed},
+	StatusFailedToCancel: {StatusSucceeded, StatusFailed},
+	StatusWaiting:        {StatusSucceeded, StatusFailed},
+}
+
+// statuses lists every status in the task lifecycle.
+var statuses = []Status{
+	StatusPending, StatusInProgress, StatusSucceeded, StatusFailed,
+	StatusPendingCancel, StatusCancelled, StatusFailedToCancel, StatusWaiting,
+	StatusExpired,
+}
+
 func (s Status) IsValid() bool {
-	switch s {
-	case StatusPending, StatusInProgress, StatusSucceeded, StatusFailed,
-		StatusPendingCancel, StatusCancelled, StatusFailedToCancel:
-		return true
+	return slices.Contains(statuses, s)
+}
+
+// CanTransitionTo reports whether the lifecycle allows moving from s to next.
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
 	}
 	return false
 }
+
+// IsTerminal reports whether s is a final status with no further transitions.
+func (s Status) IsTerminal() bool {
+	return s.IsValid() && len(transitions[s]) == 0
+}
+
+// terminalStatuses returns the terminal statuses as strings for use in queries.
+func terminalStatuses() []string {
+	var terminal []string
+	for _, s := range statuses {
+		if s.IsTerminal() {
+			terminal = append(terminal, string(s))
+		}
+	}
+	return terminal
+}
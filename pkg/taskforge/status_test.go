@@ -0,0 +1,80 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestUpdateStatusEnforcesLifecycle(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	task := &model.Task{Type: "lifecycle"}
+	if err := mgr.Enqueue(ctx, task); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	if err := mgr.UpdateStatus(ctx, task.ID, Status("exploded")); !errors.Is(err, ErrInvalidStatus) {
+		t.Fatalf("expected ErrInvalidStatus, got %v", err)
+	}
+	if err := mgr.UpdateStatus(ctx, task.ID, StatusSucceeded); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected pending -> succeeded to be rejected, got %v", err)
+	}
+	if err := mgr.UpdateStatus(ctx, task.ID, StatusInProgress); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected tasks to start only through Reserve, got %v", err)
+	}
+	reserveTask(t, mgr, task.ID)
+	if err := mgr.UpdateStatus(ctx, task.ID, StatusSucceeded); err != nil {
+		t.Fatalf("in_progress -> succeeded failed: %v", err)
+	}
+	if err := mgr.UpdateStatus(ctx, task.ID, StatusPending); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected a terminal task to stay terminal, got %v", err)
+	}
+
+	got, err := mgr.GetTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("get task failed: %v", err)
+	}
+	if got.Status != string(StatusSucceeded) {
+		t.Fatalf("expected status to remain succeeded, got %s", got.Status)
+	}
+	if !StatusSucceeded.IsTerminal() || StatusPendingCancel.IsTerminal() {
+		t.Fatalf("unexpected IsTerminal results")
+	}
+}
+
+func TestUpdateTaskLeavesStatusAlone(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	task := &model.Task{Type: "lifecycle"}
+	if err := mgr.Enqueue(ctx, task); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	edited := *task
+	edited.Payload = `{"to": "ops"}`
+	edited.Status = string(StatusSucceeded)
+	if err := mgr.UpdateTask(ctx, &edited); !errors.Is(err, ErrStatusChange) {
+		t.Fatalf("expected ErrStatusChange, got %v", err)
+	}
+
+	edited.Status = ""
+	if err := mgr.UpdateTask(ctx, &edited); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	stored, err := mgr.GetTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("get task failed: %v", err)
+	}
+	if stored.Status != string(StatusPending) || stored.Payload != edited.Payload {
+		t.Fatalf("expected the payload to change and the status to stay pending, got %q / %q", stored.Status, stored.Payload)
+	}
+	history, err := mgr.GetTaskHistory(ctx, task.ID)
+	if err != nil || len(history) != 0 {
+		t.Fatalf("expected no status history, got %d rows (%v)", len(history), err)
+	}
+}
@@ -0,0 +1,107 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+const (
+	// timeoutMessage is the error recorded when a run exceeds its timeout.
+	timeoutMessage = "execution timed out"
+
+	// expiredMessage is the history message recorded when a pending task expires.
+	expiredMessage = "expired before it started"
+)
+
+// FailTimedOutTasks fails in-progress tasks that have run past their
+// deadline. Like any failure, a retry is scheduled when the task's retry
+// policy allows another attempt; otherwise the task is dead-lettered. It
+// returns the number of tasks failed.
+func (m *Manager) FailTimedOutTasks(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	var overdue []model.Task
+	if err := m.db.WithContext(ctx).
+		Where("status = ? AND deadline_at < ?", string(StatusInProgress), now).
+		Order("deadline_at").
+		Find(&overdue).Error; err != nil {
+		return 0, err
+	}
+
+	failed := 0
+	for i := range overdue {
+		var ok bool
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// Re-check under the lock, so a worker that completes the task
+			// concurrently wins.
+			var t model.Task
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND status = ? AND deadline_at < ?", overdue[i].ID, string(StatusInProgress), now).
+				Take(&t).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if m.logger != nil {
+				m.logger.Errorf("Task ID=%s exceeded its timeout of %s", t.ID, t.Timeout)
+			}
+			ok = true
+			return m.fail(ctx, tx, &t, timeoutMessage)
+		})
+		if errors.Is(err, ErrConcurrentUpdate) {
+			continue
+		}
+		if err != nil {
+			return failed, err
+		}
+		if ok {
+			failed++
+		}
+	}
+	return failed, nil
+}
+
+// ExpirePendingTasks moves pending tasks that were not started by their
+// ExpiresAt to expired, a terminal status. Their dependents and waiting
+// parents are then resolved as for any task that did not succeed. It returns
+// the number of tasks expired.
+func (m *Manager) ExpirePendingTasks(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	var stale []model.Task
+	if err := m.db.WithContext(ctx).
+		Where("status = ? AND expires_at <= ?", string(StatusPending), now).
+		Order("expires_at").
+		Find(&stale).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for i := range stale {
+		var ok bool
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var err error
+			ok, err = m.setStatus(ctx, tx, &stale[i], StatusExpired, expiredMessage, nil)
+			if !ok || err != nil {
+				return err
+			}
+			return m.finished(ctx, tx, &stale[i])
+		})
+		if err != nil {
+			return expired, err
+		}
+		if ok {
+			if m.logger != nil {
+				m.logger.Infof("Task ID=%s expired before it started", stale[i].ID)
+			}
+			expired++
+		}
+	}
+	return expired, nil
+}
@@ -0,0 +1,106 @@
+package taskforge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestFailTimedOutTasksRetriesAndDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{Retry: RetryPolicy{Attempts: 2}})
+
+	task := &model.Task{Type: "export", Timeout: time.Minute}
+	if err := mgr.Enqueue(ctx, task); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	got, err := mgr.Reserve(ctx)
+	if err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	if got.DeadlineAt == nil || got.DeadlineAt.Sub(*got.StartedAt) != time.Minute {
+		t.Fatalf("expected a deadline one minute after the start, got %v", got.DeadlineAt)
+	}
+
+	if n, err := mgr.FailTimedOutTasks(ctx); err != nil || n != 0 {
+		t.Fatalf("expected no timeouts before the deadline, got %d (%v)", n, err)
+	}
+	past := time.Now().UTC().Add(-time.Second)
+	if err := db.Model(task).UpdateColumn("deadline_at", past).Error; err != nil {
+		t.Fatalf("failed to move deadline: %v", err)
+	}
+	if n, err := mgr.FailTimedOutTasks(ctx); err != nil || n != 1 {
+		t.Fatalf("expected one timeout, got %d (%v)", n, err)
+	}
+	failed, err := mgr.GetTask(ctx, task.ID)
+	if err != nil {
+		t.Fatalf("get task failed: %v", err)
+	}
+	if failed.Status != string(StatusFailed) || failed.LastError != timeoutMessage {
+		t.Fatalf("expected the task to fail with a timeout, got %s (%q)", failed.Status, failed.LastError)
+	}
+
+	var retry model.Task
+	if err := db.Where("retry_of_id = ?", task.ID).Take(&retry).Error; err != nil {
+		t.Fatalf("expected a retry: %v", err)
+	}
+	if retry.Timeout != time.Minute || retry.DeadlineAt != nil {
+		t.Fatalf("expected the retry to keep the timeout but not the deadline, got %s %v", retry.Timeout, retry.DeadlineAt)
+	}
+
+	// The last attempt is dead-lettered when it times out.
+	if err := db.Model(&retry).UpdateColumn("scheduled_for", nil).Error; err != nil {
+		t.Fatalf("failed to make retry due: %v", err)
+	}
+	if _, err := mgr.Reserve(ctx); err != nil {
+		t.Fatalf("reserve of retry failed: %v", err)
+	}
+	if err := db.Model(&retry).UpdateColumn("deadline_at", past).Error; err != nil {
+		t.Fatalf("failed to move deadline: %v", err)
+	}
+	if n, err := mgr.FailTimedOutTasks(ctx); err != nil || n != 1 {
+		t.Fatalf("expected the retry to time out, got %d (%v)", n, err)
+	}
+	letters, err := mgr.ListDeadLetters(ctx, nil, 0, 0)
+	if err != nil || len(letters) != 1 || letters[0].ErrorMessage != timeoutMessage {
+		t.Fatalf("expected the timed out retry to be dead-lettered, got %v (%v)", letters, err)
+	}
+}
+
+func TestExpirePendingTasks(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	past := time.Now().UTC().Add(-time.Minute)
+	future := time.Now().UTC().Add(time.Hour)
+	stale := &model.Task{Type: "notify", ExpiresAt: &past}
+	fresh := &model.Task{Type: "notify", ExpiresAt: &future}
+	for _, task := range []*model.Task{stale, fresh} {
+		if err := mgr.Enqueue(ctx, task); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+	dependent := &model.Task{Type: "digest", DependsOn: []uuid.UUID{stale.ID}, DependencyFailure: string(DependencyFail)}
+	if err := mgr.Enqueue(ctx, dependent); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	// An expired task is never reserved, even before the sweep.
+	got, err := mgr.Reserve(ctx)
+	if err != nil || got.ID != fresh.ID {
+		t.Fatalf("expected only the fresh task to be reserved, got %v (%v)", got, err)
+	}
+
+	if n, err := mgr.ExpirePendingTasks(ctx); err != nil || n != 1 {
+		t.Fatalf("expected one task to expire, got %d (%v)", n, err)
+	}
+	assertStatus(t, mgr, stale.ID, StatusExpired)
+	assertStatus(t, mgr, dependent.ID, StatusFailed)
+	if !StatusExpired.IsTerminal() {
+		t.Fatalf("expected expired to be terminal")
+	}
+}
@@ -0,0 +1,137 @@
+package taskforge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// CancelTreeOptions controls how CancelTree walks a task tree.
+type CancelTreeOptions struct {
+	PreserveCompleted bool // leave the subtrees of succeeded tasks untouched
+}
+
+// CancelTree cancels rootID and every task below it, applying CancelTask to
+// each one in a single transaction: pending tasks are cancelled and running
+// tasks are asked to stop. Terminal tasks are never changed; with
+// PreserveCompleted the walk also stops at succeeded tasks, so work that
+// follows from completed steps keeps running. It returns the number of tasks
+// cancelled or asked to stop.
+func (m *Manager) CancelTree(ctx context.Context, rootID uuid.UUID, opts CancelTreeOptions) (int, error) {
+	var cancelled int
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		descend := func(t *model.Task) bool {
+			return !opts.PreserveCompleted || Status(t.Status) != StatusSucceeded
+		}
+		tasks, _, err := m.subtree(ctx, tx, rootID, descend)
+		if err != nil {
+			return err
+		}
+		for i := range tasks {
+			ok, err := m.cancelCurrent(ctx, tx, &tasks[i])
+			if err != nil {
+				return err
+			}
+			if ok {
+				cancelled++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if m.logger != nil {
+		m.logger.Infof("Cancelled %d tasks in tree of task ID=%s", cancelled, rootID)
+	}
+	return cancelled, nil
+}
+
+// cancelCurrent cancels t, re-reading it whenever its status changed since it
+// was loaded, e.g. because a worker reserved it in the meantime.
+func (m *Manager) cancelCurrent(ctx context.Context, tx *gorm.DB, t *model.Task) (bool, error) {
+	for {
+		from := t.Status
+		ok, err := m.requestCancel(ctx, tx, t)
+		if ok || err != nil {
+			return ok, err
+		}
+		if err := tx.First(t, "id = ?", t.ID).Error; err != nil {
+			return false, err
+		}
+		if t.Status == from {
+			return false, nil
+		}
+	}
+}
+
+// RetryFailedSubtree creates a retry for every failed leaf below and including
+// rootID, leaving succeeded and still-running parts of the tree alone. A failed
+// task that already has a retry is not a leaf, so only the latest attempt of
+// each step is retried. It returns the new retry tasks.
+func (m *Manager) RetryFailedSubtree(ctx context.Context, rootID uuid.UUID) ([]model.Task, error) {
+	retries := []model.Task{}
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tasks, parents, err := m.subtree(ctx, tx, rootID, nil)
+		if err != nil {
+			return err
+		}
+		for _, t := range tasks {
+			if Status(t.Status) != StatusFailed || parents[t.ID] {
+				continue
+			}
+			retry := newRetryTask(t)
+			if err := m.scheduleRetry(ctx, tx, &t, &retry, retryMessage(t)); err != nil {
+				return fmt.Errorf("taskforge: failed to retry task %s: %w", t.ID, err)
+			}
+			retries = append(retries, retry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return retries, nil
+}
+
+// subtree loads rootID and its descendants breadth-first, root first. Children
+// of a task are only loaded when descend is nil or returns true for it. It
+// also reports which of the loaded tasks have children.
+func (m *Manager) subtree(ctx context.Context, db *gorm.DB, rootID uuid.UUID, descend func(*model.Task) bool) ([]model.Task, map[uuid.UUID]bool, error) {
+	var root model.Task
+	if err := db.WithContext(ctx).First(&root, "id = ?", rootID).Error; err != nil {
+		return nil, nil, err
+	}
+
+	tasks := []model.Task{root}
+	parents := make(map[uuid.UUID]bool)
+	for level := 0; level < len(tasks); {
+		var ids []uuid.UUID
+		for i := level; i < len(tasks); i++ {
+			if descend == nil || descend(&tasks[i]) {
+				ids = append(ids, tasks[i].ID)
+			}
+		}
+		level = len(tasks)
+		if len(ids) == 0 {
+			break
+		}
+
+		var children []model.Task
+		if err := db.WithContext(ctx).
+			Where("parent_task_id IN ?", ids).
+			Order("friendly_id").
+			Find(&children).Error; err != nil {
+			return nil, nil, fmt.Errorf("taskforge: failed to get child tasks: %w", err)
+		}
+		for _, child := range children {
+			parents[*child.ParentTaskID] = true
+		}
+		tasks = append(tasks, children...)
+	}
+	return tasks, parents, nil
+}
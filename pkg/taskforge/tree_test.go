@@ -0,0 +1,119 @@
+package taskforge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// seedTree creates root -> {done -> {followUp}, running, waiting} and returns the tasks by name.
+func seedTree(t *testing.T, db *gorm.DB) map[string]*model.Task {
+	t.Helper()
+	tasks := map[string]*model.Task{
+		"root":     {Type: "orchestrate", Status: string(StatusInProgress)},
+		"done":     {Type: "step", Status: string(StatusSucceeded)},
+		"followUp": {Type: "step", Status: string(StatusPending)},
+		"running":  {Type: "step", Status: string(StatusInProgress)},
+		"waiting":  {Type: "step", Status: string(StatusPending)},
+	}
+	parents := map[string]string{"done": "root", "followUp": "done", "running": "root", "waiting": "root"}
+	for _, name := range []string{"root", "done", "followUp", "running", "waiting"} {
+		task := tasks[name]
+		if parent, ok := parents[name]; ok {
+			task.ParentTaskID = &tasks[parent].ID
+		}
+		if err := db.Create(task).Error; err != nil {
+			t.Fatalf("failed to seed %s: %v", name, err)
+		}
+	}
+	return tasks
+}
+
+func TestCancelTree(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		name     string
+		opts     CancelTreeOptions
+		want     int
+		followUp Status
+	}{
+		{"whole tree", CancelTreeOptions{}, 4, StatusCancelled},
+		{"preserve completed", CancelTreeOptions{PreserveCompleted: true}, 3, StatusPending},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mgr, db := newTestManager(t, Config{})
+			tasks := seedTree(t, db)
+
+			n, err := mgr.CancelTree(ctx, tasks["root"].ID, tc.opts)
+			if err != nil {
+				t.Fatalf("cancel tree failed: %v", err)
+			}
+			if n != tc.want {
+				t.Fatalf("expected %d tasks cancelled, got %d", tc.want, n)
+			}
+			want := map[string]Status{
+				"root":     StatusPendingCancel,
+				"done":     StatusSucceeded,
+				"followUp": tc.followUp,
+				"running":  StatusPendingCancel,
+				"waiting":  StatusCancelled,
+			}
+			for name, status := range want {
+				got, err := mgr.GetTask(ctx, tasks[name].ID)
+				if err != nil {
+					t.Fatalf("get %s failed: %v", name, err)
+				}
+				if got.Status != string(status) {
+					t.Fatalf("%s: expected %s, got %s", name, status, got.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryFailedSubtree(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+
+	root := model.Task{Type: "orchestrate", Status: string(StatusFailed)}
+	if err := db.Create(&root).Error; err != nil {
+		t.Fatalf("failed to seed root: %v", err)
+	}
+	child := func(parent uuid.UUID, status Status) model.Task {
+		task := model.Task{Type: "step", Status: string(status), ParentTaskID: &parent}
+		if err := db.Create(&task).Error; err != nil {
+			t.Fatalf("failed to seed child: %v", err)
+		}
+		return task
+	}
+	ok := child(root.ID, StatusSucceeded)
+	failedLeaf := child(root.ID, StatusFailed)
+	retried := child(root.ID, StatusFailed)
+	retry := child(retried.ID, StatusFailed)
+
+	retries, err := mgr.RetryFailedSubtree(ctx, root.ID)
+	if err != nil {
+		t.Fatalf("retry subtree failed: %v", err)
+	}
+	if len(retries) != 2 {
+		t.Fatalf("expected 2 retries, got %d", len(retries))
+	}
+	retriedIDs := map[uuid.UUID]bool{}
+	for _, r := range retries {
+		if r.Status != string(StatusPending) || r.RetryOfID == nil {
+			t.Fatalf("unexpected retry task: %+v", r)
+		}
+		retriedIDs[*r.RetryOfID] = true
+	}
+	if !retriedIDs[failedLeaf.ID] || !retriedIDs[retry.ID] {
+		t.Fatalf("expected the failed leaves to be retried, got %v", retriedIDs)
+	}
+	if retriedIDs[root.ID] || retriedIDs[retried.ID] || retriedIDs[ok.ID] {
+		t.Fatalf("expected only failed leaves to be retried, got %v", retriedIDs)
+	}
+}
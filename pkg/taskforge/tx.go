@@ -0,0 +1,37 @@
+package taskforge
+
+import "gorm.io/gorm"
+
+// WithTx returns a Manager that runs its operations inside tx, a transaction
+// begun by the caller. Tasks enqueued through it, e.g. with Enqueue,
+// EnqueueBatch, CreateTask or CreateTaskFromTemplate, are committed or rolled
+// back together with the caller's own writes:
+//
+//	err := db.Transaction(func(tx *gorm.DB) error {
+//		if err := tx.Create(&order).Error; err != nil {
+//			return err
+//		}
+//		return mgr.WithTx(tx).Enqueue(ctx, &model.Task{Type: "ship-order", ReferenceID: order.Number})
+//	})
+//
+// Operations that need a transaction of their own run in a savepoint of tx.
+// The returned Manager shares m's configuration, must not be used once tx has
+// finished, and cannot be started.
+func (m *Manager) WithTx(tx *gorm.DB) *Manager {
+	return &Manager{
+		cfg:     m.cfg,
+		db:      tx,
+		table:   m.table,
+		retry:   m.retry,
+		cleanup: m.cleanup,
+		keep:    m.keep,
+		aging:   m.aging,
+		lease:   m.lease,
+		reap:    m.reap,
+		cancel:  m.cancel,
+		dedupe:  m.dedupe,
+		logger:  m.logger,
+		ctx:     m.ctx,
+		inTx:    true,
+	}
+}
@@ -0,0 +1,77 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestWithTxFollowsCallerTransaction(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+
+	worker := model.WorkerType{Name: "shipper"}
+	if err := db.Create(&worker).Error; err != nil {
+		t.Fatalf("failed to seed worker type: %v", err)
+	}
+	tpl := model.TaskTemplate{Name: "ship", WorkerTypeID: worker.ID, DefaultInputs: `{"carrier": "post"}`}
+	if err := db.Create(&tpl).Error; err != nil {
+		t.Fatalf("failed to seed template: %v", err)
+	}
+
+	errRollback := errors.New("rollback")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		txm := mgr.WithTx(tx)
+		if err := txm.Enqueue(ctx, &model.Task{Type: "shipper", ReferenceID: "order-1"}); err != nil {
+			return err
+		}
+		if _, err := txm.CreateTaskFromTemplate(ctx, tpl.ID, nil, nil); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("expected the transaction to roll back, got %v", err)
+	}
+	var count int64
+	db.Model(&model.Task{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no tasks after rollback, got %d", count)
+	}
+	db.Model(&model.TaskInput{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no task inputs after rollback, got %d", count)
+	}
+
+	committed := &model.Task{Type: "shipper", ReferenceID: "order-2", UniqueActive: true}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		txm := mgr.WithTx(tx)
+		if err := txm.Enqueue(ctx, committed); err != nil {
+			return err
+		}
+		// A rejected duplicate leaves the caller's transaction usable.
+		duplicate := &model.Task{Type: "shipper", ReferenceID: "order-2", UniqueActive: true}
+		if err := txm.Enqueue(ctx, duplicate); !errors.Is(err, ErrTaskConflict) {
+			t.Errorf("expected ErrTaskConflict, got %v", err)
+		}
+		return txm.CreateTask(ctx, &model.Task{Type: "shipper", ReferenceID: "order-3"})
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	db.Model(&model.Task{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected 2 committed tasks, got %d", count)
+	}
+	if _, err := mgr.GetTask(ctx, committed.ID); err != nil {
+		t.Fatalf("expected the enqueued task to be committed: %v", err)
+	}
+
+	if err := mgr.WithTx(db).Start(ctx); err == nil {
+		t.Fatalf("expected a transaction-bound Manager to refuse to start")
+	}
+}
@@ -0,0 +1,197 @@
+package taskforge
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+// ConflictPolicy decides what happens when a unique task is enqueued while an
+// active task with the same type and reference ID exists.
+type ConflictPolicy string
+
+const (
+	ConflictReject   ConflictPolicy = "reject"   // fail with ErrTaskConflict
+	ConflictReplace  ConflictPolicy = "replace"  // cancel the pending task and enqueue the new one; reject if it is running
+	ConflictCoalesce ConflictPolicy = "coalesce" // return the active task instead of enqueueing
+)
+
+// maxReplaceAttempts bounds how often create cancels a conflicting task before
+// giving up, in case other producers keep replacing it concurrently.
+const maxReplaceAttempts = 3
+
+// create inserts t, honouring its idempotency key, uniqueness settings and
+// dependencies. Keys and uniqueness are enforced by unique indexes: every
+// lookup is a single statement, so a concurrent enqueue that wins the race
+// makes our insert fail, and the conflict is then resolved against the winner.
+func (m *Manager) create(ctx context.Context, t *model.Task) error {
+	return m.createWith(ctx, t, nil)
+}
+
+// createWith is create with also, if set, run in the transaction that inserts
+// t, for rows that must be stored along with it. It is not run when t resolves
+// to an existing task.
+func (m *Manager) createWith(ctx context.Context, t *model.Task, also func(tx *gorm.DB) error) error {
+	if err := validateChildPolicy(t); err != nil {
+		return err
+	}
+	utcTimes(t)
+	db := m.db.WithContext(ctx)
+	policy, err := m.uniqueness(db, t)
+	if err != nil {
+		return err
+	}
+
+	if t.IdempotencyKey != nil {
+		existing, err := m.findIdempotent(db, t)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			m.reuse(t, existing, fmt.Sprintf("idempotency key %q", *t.IdempotencyKey))
+			return nil
+		}
+	}
+
+	deps, err := m.resolveDependencies(db, t)
+	if err != nil {
+		return err
+	}
+	insert := func() error { return db.Create(t).Error }
+	if len(deps) > 0 || also != nil || m.inTx {
+		// The task and its dependencies are inserted together so no worker
+		// can reserve it before its dependencies are recorded. Inside a
+		// caller's transaction this is a savepoint, so a conflicting insert
+		// does not abort the caller's transaction.
+		insert = func() error {
+			return db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Create(t).Error; err != nil {
+					return err
+				}
+				if len(deps) > 0 {
+					if err := m.addDependencies(tx, t, deps); err != nil {
+						return err
+					}
+				}
+				if also != nil {
+					return also(tx)
+				}
+				return nil
+			})
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := insert()
+		if err == nil {
+			return m.checkDependencies(ctx, t, deps)
+		}
+
+		if t.IdempotencyKey != nil {
+			if winner, ferr := m.findIdempotent(db, t); ferr == nil && winner != nil {
+				m.reuse(t, winner, fmt.Sprintf("idempotency key %q", *t.IdempotencyKey))
+				return nil
+			}
+		}
+		if !t.UniqueActive {
+			return err
+		}
+		active, ferr := m.findActive(db, t)
+		if ferr != nil || active == nil {
+			return err
+		}
+
+		switch policy {
+		case ConflictCoalesce:
+			m.reuse(t, active, fmt.Sprintf("reference %q", t.ReferenceID))
+			return nil
+		case ConflictReplace:
+			if Status(active.Status) != StatusPending {
+				// Cancelling a running task only requests it; replacing it
+				// now would run the job twice.
+				return fmt.Errorf("%w: task %s is running", ErrTaskConflict, active.ID)
+			}
+			if attempt >= maxReplaceAttempts {
+				return fmt.Errorf("%w: task %s", ErrTaskConflict, active.ID)
+			}
+			if m.logger != nil {
+				m.logger.Infof("Replacing active task ID=%s of type %s", active.ID, active.Type)
+			}
+			if err := m.CancelTask(ctx, active.ID); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: task %s", ErrTaskConflict, active.ID)
+		}
+	}
+}
+
+// uniqueness applies the task type's uniqueness settings to t and returns the
+// conflict policy to use. Settings on t take precedence over its type's.
+func (m *Manager) uniqueness(db *gorm.DB, t *model.Task) (ConflictPolicy, error) {
+	var wt model.WorkerType
+	if err := db.Where("name = ?", t.Type).Limit(1).Find(&wt).Error; err != nil {
+		return "", err
+	}
+	if wt.UniqueActive {
+		t.UniqueActive = true
+	}
+
+	policy := ConflictPolicy(t.ConflictPolicy)
+	if policy == "" {
+		policy = ConflictPolicy(wt.ConflictPolicy)
+	}
+	switch policy {
+	case "":
+		return ConflictReject, nil
+	case ConflictReject, ConflictReplace, ConflictCoalesce:
+		return policy, nil
+	}
+	return "", fmt.Errorf("taskforge: invalid conflict policy %q", policy)
+}
+
+// activeStatuses are the statuses covered by the unique index: pending tasks
+// and tasks that may still be running.
+func activeStatuses() []string {
+	return append([]string{string(StatusPending)}, runningStatuses()...)
+}
+
+// findActive returns the pending or running unique task that t conflicts with,
+// or nil if there is none.
+func (m *Manager) findActive(db *gorm.DB, t *model.Task) (*model.Task, error) {
+	var active []model.Task
+	if err := db.Where("type = ? AND reference_id = ? AND unique_active = ? AND status IN ?",
+		t.Type, t.ReferenceID, true, activeStatuses()).
+		Limit(1).
+		Find(&active).Error; err != nil {
+		return nil, err
+	}
+	if len(active) == 0 {
+		return nil, nil
+	}
+	return &active[0], nil
+}
+
+// reuse replaces t with an existing task that an enqueue resolved to.
+func (m *Manager) reuse(t, existing *model.Task, reason string) {
+	if m.logger != nil {
+		m.logger.Infof("Enqueue of %s task matched existing task ID=%s by %s", t.Type, existing.ID, reason)
+	}
+	*t = *existing
+}
+
+// utcTimes converts the times a caller may set on t to UTC. SQLite compares
+// times as text, so they must be stored in the zone they are compared in.
+func utcTimes(t *model.Task) {
+	if t.ScheduledFor != nil {
+		scheduled := t.ScheduledFor.UTC()
+		t.ScheduledFor = &scheduled
+	}
+	if t.ExpiresAt != nil {
+		expires := t.ExpiresAt.UTC()
+		t.ExpiresAt = &expires
+	}
+}
@@ -0,0 +1,238 @@
+package taskforge
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/agincgit/taskforge/pkg/model"
+)
+
+func TestUniqueTaskConflictPolicies(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+
+	first := &model.Task{Type: "sync", ReferenceID: "acct-1", UniqueActive: true}
+	if err := mgr.Enqueue(ctx, first); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	rejected := &model.Task{Type: "sync", ReferenceID: "acct-1", UniqueActive: true}
+	if err := mgr.Enqueue(ctx, rejected); !errors.Is(err, ErrTaskConflict) {
+		t.Fatalf("expected ErrTaskConflict, got %v", err)
+	}
+
+	other := &model.Task{Type: "sync", ReferenceID: "acct-2", UniqueActive: true}
+	if err := mgr.Enqueue(ctx, other); err != nil {
+		t.Fatalf("enqueue for another reference failed: %v", err)
+	}
+
+	coalesced := &model.Task{Type: "sync", ReferenceID: "acct-1", UniqueActive: true, ConflictPolicy: string(ConflictCoalesce)}
+	if err := mgr.Enqueue(ctx, coalesced); err != nil {
+		t.Fatalf("coalescing enqueue failed: %v", err)
+	}
+	if coalesced.ID != first.ID {
+		t.Fatalf("expected the active task to be returned, got %s", coalesced.ID)
+	}
+
+	replacement := &model.Task{Type: "sync", ReferenceID: "acct-1", UniqueActive: true, ConflictPolicy: string(ConflictReplace)}
+	if err := mgr.Enqueue(ctx, replacement); err != nil {
+		t.Fatalf("replacing enqueue failed: %v", err)
+	}
+	if replacement.ID == first.ID {
+		t.Fatalf("expected a new task to replace the active one")
+	}
+	replaced, err := mgr.GetTask(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("failed to load replaced task: %v", err)
+	}
+	if replaced.Status != string(StatusCancelled) {
+		t.Fatalf("expected the replaced task to be cancelled, got %s", replaced.Status)
+	}
+
+	// Finished tasks free the slot.
+	if err := mgr.SetPriority(ctx, replacement.ID, 1); err != nil {
+		t.Fatalf("set priority failed: %v", err)
+	}
+	reserveTask(t, mgr, replacement.ID)
+	if err := mgr.Complete(ctx, replacement.ID, true); err != nil {
+		t.Fatalf("failed to complete task: %v", err)
+	}
+	next := &model.Task{Type: "sync", ReferenceID: "acct-1", UniqueActive: true}
+	if err := mgr.Enqueue(ctx, next); err != nil {
+		t.Fatalf("enqueue after completion failed: %v", err)
+	}
+
+	var active int64
+	db.Model(&model.Task{}).Where("reference_id = ? AND status IN ?", "acct-1", []string{"pending", "in_progress"}).Count(&active)
+	if active != 1 {
+		t.Fatalf("expected one active task for the reference, got %d", active)
+	}
+}
+
+func TestUniqueTaskNeverRunsTwice(t *testing.T) {
+	ctx := context.Background()
+	mgr, _ := newTestManager(t, Config{})
+
+	running := &model.Task{Type: "sync", ReferenceID: "acct-1", UniqueActive: true}
+	if err := mgr.Enqueue(ctx, running); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if _, err := mgr.Reserve(ctx); err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+
+	replacement := &model.Task{Type: "sync", ReferenceID: "acct-1", UniqueActive: true, ConflictPolicy: string(ConflictReplace)}
+	if err := mgr.Enqueue(ctx, replacement); !errors.Is(err, ErrTaskConflict) {
+		t.Fatalf("expected replacing a running task to be rejected, got %v", err)
+	}
+	assertStatus(t, mgr, running.ID, StatusInProgress)
+
+	// A run whose cancellation is pending, or has failed, still holds the slot.
+	if err := mgr.CancelTask(ctx, running.ID); err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+	for _, status := range []Status{StatusPendingCancel, StatusFailedToCancel} {
+		if status == StatusFailedToCancel {
+			if err := mgr.AcknowledgeCancel(ctx, running.ID, false); err != nil {
+				t.Fatalf("acknowledge failed: %v", err)
+			}
+		}
+		assertStatus(t, mgr, running.ID, status)
+		for _, policy := range []ConflictPolicy{ConflictReject, ConflictReplace} {
+			next := &model.Task{Type: "sync", ReferenceID: "acct-1", UniqueActive: true, ConflictPolicy: string(policy)}
+			if err := mgr.Enqueue(ctx, next); !errors.Is(err, ErrTaskConflict) {
+				t.Fatalf("%s: expected %s enqueue to conflict, got %v", status, policy, err)
+			}
+		}
+	}
+
+	if err := mgr.Complete(ctx, running.ID, true); err != nil {
+		t.Fatalf("complete failed: %v", err)
+	}
+	if err := mgr.Enqueue(ctx, &model.Task{Type: "sync", ReferenceID: "acct-1", UniqueActive: true}); err != nil {
+		t.Fatalf("enqueue after the run finished failed: %v", err)
+	}
+}
+
+func TestUniqueTaskSettingsFromWorkerType(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+
+	wt := &model.WorkerType{Name: "report", UniqueActive: true, ConflictPolicy: string(ConflictCoalesce)}
+	if err := db.Create(wt).Error; err != nil {
+		t.Fatalf("failed to create worker type: %v", err)
+	}
+
+	first := &model.Task{Type: "report", ReferenceID: "daily"}
+	if err := mgr.Enqueue(ctx, first); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if !first.UniqueActive {
+		t.Fatalf("expected the worker type to mark the task unique")
+	}
+	again := &model.Task{Type: "report", ReferenceID: "daily"}
+	if err := mgr.Enqueue(ctx, again); err != nil {
+		t.Fatalf("second enqueue failed: %v", err)
+	}
+	if again.ID != first.ID {
+		t.Fatalf("expected the worker type's coalesce policy to apply")
+	}
+
+	bad := &model.Task{Type: "report", ReferenceID: "weekly", ConflictPolicy: "merge"}
+	if err := mgr.Enqueue(ctx, bad); err == nil {
+		t.Fatalf("expected an invalid conflict policy to be rejected")
+	}
+}
+
+func TestUniqueTaskFromTemplate(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+
+	wt := &model.WorkerType{Name: "rebuild-index", UniqueActive: true, ConflictPolicy: string(ConflictCoalesce)}
+	if err := db.Create(wt).Error; err != nil {
+		t.Fatalf("failed to create worker type: %v", err)
+	}
+	tpl := &model.TaskTemplate{Name: "nightly-rebuild", WorkerTypeID: wt.ID, DefaultInputs: `{"full": true}`}
+	if err := db.Create(tpl).Error; err != nil {
+		t.Fatalf("failed to create template: %v", err)
+	}
+
+	first, err := mgr.CreateTaskFromTemplate(ctx, tpl.ID, nil, nil)
+	if err != nil {
+		t.Fatalf("create from template failed: %v", err)
+	}
+	if !first.UniqueActive {
+		t.Fatalf("expected the worker type to mark the template task unique")
+	}
+	second, err := mgr.CreateTaskFromTemplate(ctx, tpl.ID, nil, nil)
+	if err != nil {
+		t.Fatalf("second create from template failed: %v", err)
+	}
+	if second.ID != first.ID {
+		t.Fatalf("expected the active task to be returned, got %s", second.ID)
+	}
+
+	var tasks, inputs int64
+	db.Model(&model.Task{}).Where("type = ?", "rebuild-index").Count(&tasks)
+	db.Model(&model.TaskInput{}).Count(&inputs)
+	if tasks != 1 || inputs != 1 {
+		t.Fatalf("expected one task with one input, got %d tasks and %d inputs", tasks, inputs)
+	}
+
+	if err := db.Model(wt).Update("conflict_policy", string(ConflictReject)).Error; err != nil {
+		t.Fatalf("failed to update worker type: %v", err)
+	}
+	if _, err := mgr.CreateTaskFromTemplate(ctx, tpl.ID, nil, nil); !errors.Is(err, ErrTaskConflict) {
+		t.Fatalf("expected ErrTaskConflict, got %v", err)
+	}
+}
+
+func TestUniqueTaskEnforcedByDatabase(t *testing.T) {
+	mgr, db := newTestManager(t, Config{})
+
+	first := &model.Task{Type: "sync", ReferenceID: "acct-1", UniqueActive: true}
+	if err := mgr.Enqueue(context.Background(), first); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	raw := &model.Task{Type: "sync", ReferenceID: "acct-1", UniqueActive: true, Status: string(StatusPending)}
+	if err := db.Create(raw).Error; err == nil {
+		t.Fatalf("expected the unique index to reject a duplicate active task")
+	}
+	plain := &model.Task{Type: "sync", ReferenceID: "acct-1", Status: string(StatusPending)}
+	if err := db.Create(plain).Error; err != nil {
+		t.Fatalf("expected non-unique tasks to be unaffected, got %v", err)
+	}
+}
+
+func TestConcurrentUniqueEnqueueCreatesOneTask(t *testing.T) {
+	ctx := context.Background()
+	mgr, db := newTestManager(t, Config{})
+
+	const producers = 8
+	var wg sync.WaitGroup
+	var conflicts atomic.Int32
+	for i := 0; i < producers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task := &model.Task{Type: "reindex", ReferenceID: "customer-9", UniqueActive: true}
+			err := mgr.Enqueue(ctx, task)
+			switch {
+			case errors.Is(err, ErrTaskConflict):
+				conflicts.Add(1)
+			case err != nil:
+				t.Errorf("enqueue failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var count int64
+	db.Model(&model.Task{}).Where("type = ?", "reindex").Count(&count)
+	if count != 1 || conflicts.Load() != producers-1 {
+		t.Fatalf("expected one task and %d conflicts, got %d tasks and %d conflicts", producers-1, count, conflicts.Load())
+	}
+}
@@ -0,0 +1,402 @@
+// Package worker provides a polling worker runtime that dispatches reserved tasks
+// to handlers registered by task type.
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/agincgit/taskforge/pkg/model"
+	"github.com/agincgit/taskforge/pkg/taskforge"
+)
+
+const (
+	defaultConcurrency  = 1
+	defaultPollInterval = time.Second
+)
+
+// HandlerFunc processes a single reserved task. Returning a non-nil error marks
+// the task as failed with the error's message; returning nil marks it as succeeded.
+type HandlerFunc func(ctx context.Context, t *model.Task) error
+
+// Option configures optional Worker behaviors.
+type Option func(*Worker)
+
+// WithConcurrency sets how many tasks may be processed at the same time.
+func WithConcurrency(n int) Option {
+	return func(w *Worker) {
+		if n > 0 {
+			w.concurrency = n
+		}
+	}
+}
+
+// WithPollInterval sets how long the worker waits before polling again when the
+// queue is empty or a reservation fails.
+func WithPollInterval(d time.Duration) Option {
+	return func(w *Worker) {
+		if d > 0 {
+			w.pollInterval = d
+		}
+	}
+}
+
+// WithLease sets the lease requested for reserved tasks. While a handler runs,
+// the worker extends the lease every half period so the task is only reclaimed
+// if the worker itself stops.
+func WithLease(d time.Duration) Option {
+	return func(w *Worker) {
+		if d > 0 {
+			w.lease = d
+		}
+	}
+}
+
+// WithHeartbeat sets how often the worker extends the lease of a running task
+// and checks whether its cancellation was requested. It defaults to half the
+// lease; a shorter interval reacts to cancellations sooner.
+func WithHeartbeat(d time.Duration) Option {
+	return func(w *Worker) {
+		if d > 0 {
+			w.heartbeat = d
+		}
+	}
+}
+
+// WithQueue restricts the worker to tasks in the named queue.
+func WithQueue(queue string) Option {
+	return func(w *Worker) {
+		w.queue = queue
+	}
+}
+
+// WithWorkerID records id as the worker on every task this worker reserves, so
+// failures and dead letter entries can be traced back to it.
+func WithWorkerID(id uuid.UUID) Option {
+	return func(w *Worker) {
+		w.workerID = id
+	}
+}
+
+// WithLogger installs a logger used for informational and error logs.
+func WithLogger(l taskforge.Logger) Option {
+	return func(w *Worker) {
+		w.logger = l
+	}
+}
+
+// Worker reserves tasks from a TaskManager and dispatches them to registered handlers.
+type Worker struct {
+	mgr          taskforge.TaskManager
+	concurrency  int
+	pollInterval time.Duration
+	lease        time.Duration
+	heartbeat    time.Duration
+	queue        string
+	workerID     uuid.UUID
+	logger       taskforge.Logger
+
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+}
+
+// New constructs a Worker backed by the provided task manager.
+func New(mgr taskforge.TaskManager, opts ...Option) *Worker {
+	w := &Worker{
+		mgr:          mgr,
+		concurrency:  defaultConcurrency,
+		pollInterval: defaultPollInterval,
+		lease:        taskforge.DefaultLeaseDuration,
+		handlers:     make(map[string]HandlerFunc),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Handle registers the handler for tasks of the given type, replacing any
+// previously registered handler for that type.
+func (w *Worker) Handle(taskType string, h HandlerFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers[taskType] = h
+}
+
+// Run polls for tasks until ctx is cancelled, then waits for in-flight handlers
+// to finish before returning. Each poll reserves a batch sized to the number of
+// idle slots, so a busy worker claims several tasks per round trip.
+func (w *Worker) Run(ctx context.Context) error {
+	if ctx == nil {
+		return errors.New("worker: context is required")
+	}
+
+	slots := make(chan struct{}, w.concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		free := acquire(ctx, slots)
+		if free == 0 {
+			return nil
+		}
+		if free > taskforge.MaxReserveBatch {
+			release(slots, free-taskforge.MaxReserveBatch)
+			free = taskforge.MaxReserveBatch
+		}
+
+		opts := w.reserveOptions()
+		if len(opts.Types) == 0 {
+			release(slots, free)
+			if !w.sleep(ctx) {
+				return nil
+			}
+			continue
+		}
+
+		// ReserveN may fail after claiming some tasks; those are still ours.
+		tasks, err := w.mgr.ReserveN(ctx, free, opts)
+		release(slots, free-len(tasks))
+		if err != nil {
+			if ctx.Err() != nil {
+				w.releaseAll(ctx, tasks)
+				release(slots, len(tasks))
+				return nil
+			}
+			w.logError("worker: reserve failed: %v", err)
+		}
+		if len(tasks) == 0 {
+			if !w.sleep(ctx) {
+				return nil
+			}
+			continue
+		}
+
+		for i := range tasks {
+			wg.Add(1)
+			go func(t *model.Task) {
+				defer wg.Done()
+				defer release(slots, 1)
+				w.process(ctx, t)
+			}(&tasks[i])
+		}
+	}
+}
+
+// acquire blocks until at least one processing slot is free, then grabs every
+// other free slot so a single ReserveN call can fill them all. It returns 0
+// once ctx is cancelled.
+func acquire(ctx context.Context, slots chan struct{}) int {
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return 0
+	}
+	n := 1
+	for n < cap(slots) {
+		select {
+		case slots <- struct{}{}:
+			n++
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+func release(slots chan struct{}, n int) {
+	for i := 0; i < n; i++ {
+		<-slots
+	}
+}
+
+// releaseAll hands tasks reserved during shutdown back to the queue.
+func (w *Worker) releaseAll(ctx context.Context, tasks []model.Task) {
+	bg := context.WithoutCancel(ctx)
+	for i := range tasks {
+		if err := w.mgr.Release(bg, tasks[i].ID); err != nil {
+			w.logError("worker: failed to release task %s: %v", tasks[i].ID, err)
+		}
+	}
+}
+
+// reserveOptions limits reservations to the registered task types and the
+// configured queue, so the worker never claims tasks it cannot process.
+func (w *Worker) reserveOptions() taskforge.ReserveOptions {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	types := make([]string, 0, len(w.handlers))
+	for taskType := range w.handlers {
+		types = append(types, taskType)
+	}
+	return taskforge.ReserveOptions{Types: types, Queue: w.queue, Lease: w.lease, WorkerID: w.workerID}
+}
+
+// process runs the handler for t and records the outcome. The outcome is
+// recorded even if ctx has been cancelled while the handler was running,
+// unless the handler returned because of it: the task is then released back to
+// pending for another worker. The handler's context expires at the task's
+// deadline, if it has a timeout. If cancellation of the task is requested, the
+// handler's context is cancelled and the outcome is reported through
+// AcknowledgeCancel instead.
+func (w *Worker) process(ctx context.Context, t *model.Task) {
+	var hctx context.Context
+	var cancel context.CancelFunc
+	if t.DeadlineAt != nil {
+		hctx, cancel = context.WithDeadline(ctx, *t.DeadlineAt)
+	} else {
+		hctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	var cancelRequested atomic.Bool
+	stop := w.keepAlive(ctx, t, func() {
+		cancelRequested.Store(true)
+		cancel()
+	})
+	err := w.dispatch(hctx, t)
+	stop()
+
+	bg := context.WithoutCancel(ctx)
+	if cancelRequested.Load() {
+		w.acknowledgeCancel(bg, t, err)
+		return
+	}
+	if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		// The handler was stopped by shutdown, not by a fault of the task, so
+		// it goes back to the queue without using up an attempt.
+		w.logInfo("worker: task %s (%s) interrupted by shutdown, releasing it", t.ID, t.Type)
+		if rerr := w.mgr.Release(bg, t.ID); rerr != nil {
+			w.logError("worker: failed to release task %s: %v", t.ID, rerr)
+		}
+		return
+	}
+	w.report(bg, t, err)
+}
+
+// report records the handler's outcome for t: an error fails the task, nil
+// completes it.
+func (w *Worker) report(ctx context.Context, t *model.Task, err error) {
+	var cerr error
+	if err != nil {
+		w.logError("worker: task %s (%s) failed: %v", t.ID, t.Type, err)
+		cerr = w.mgr.Fail(ctx, t.ID, err.Error())
+	} else {
+		w.logInfo("worker: task %s (%s) succeeded", t.ID, t.Type)
+		cerr = w.mgr.Complete(ctx, t.ID, true)
+	}
+	if cerr != nil {
+		w.logError("worker: failed to complete task %s: %v", t.ID, cerr)
+	}
+}
+
+// acknowledgeCancel reports the outcome of a task whose cancellation was
+// requested. A handler that returned an error is taken to have stopped; one
+// that returned nil finished its work anyway, so the cancellation failed and
+// the task is completed. If the cancellation timed out before the handler
+// returned, the task is already failed_to_cancel and the handler's outcome is
+// reported as usual.
+func (w *Worker) acknowledgeCancel(ctx context.Context, t *model.Task, err error) {
+	cancelled := err != nil
+	if cancelled {
+		w.logInfo("worker: task %s (%s) cancelled", t.ID, t.Type)
+	} else {
+		w.logInfo("worker: task %s (%s) finished before it could be cancelled", t.ID, t.Type)
+	}
+	aerr := w.mgr.AcknowledgeCancel(ctx, t.ID, cancelled)
+	switch {
+	case errors.Is(aerr, taskforge.ErrTaskNotCancelling):
+		w.report(ctx, t, err)
+		return
+	case aerr != nil:
+		w.logError("worker: failed to acknowledge cancellation of task %s: %v", t.ID, aerr)
+		return
+	}
+	if cancelled {
+		return
+	}
+	if cerr := w.mgr.Complete(ctx, t.ID, true); cerr != nil {
+		w.logError("worker: failed to complete task %s: %v", t.ID, cerr)
+	}
+}
+
+// keepAlive extends the lease of t every heartbeat until the returned stop
+// function is called. onCancel is called once if the manager reports that
+// cancellation of t was requested.
+func (w *Worker) keepAlive(ctx context.Context, t *model.Task, onCancel func()) (stop func()) {
+	interval := w.heartbeat
+	if interval <= 0 {
+		interval = w.lease / 2
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var once sync.Once
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				cancelRequested, err := w.mgr.ExtendLease(context.WithoutCancel(ctx), t.ID, w.lease)
+				switch {
+				case err != nil:
+					w.logError("worker: failed to extend lease of task %s: %v", t.ID, err)
+				case cancelRequested:
+					once.Do(onCancel)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+func (w *Worker) dispatch(ctx context.Context, t *model.Task) (err error) {
+	w.mu.RLock()
+	h, ok := w.handlers[t.Type]
+	w.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("worker: no handler registered for task type %q", t.Type)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("worker: handler panicked: %v", r)
+		}
+	}()
+	return h(ctx, t)
+}
+
+// sleep waits for the poll interval and reports whether the worker should keep running.
+func (w *Worker) sleep(ctx context.Context) bool {
+	timer := time.NewTimer(w.pollInterval)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (w *Worker) logInfo(format string, args ...interface{}) {
+	if w.logger != nil {
+		w.logger.Infof(format, args...)
+	}
+}
+
+func (w *Worker) logError(format string, args ...interface{}) {
+	if w.logger != nil {
+		w.logger.Errorf(format, args...)
+	}
+}
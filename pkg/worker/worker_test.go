@@ -0,0 +1,499 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/agincgit/taskforge/pkg/model"
+	"github.com/agincgit/taskforge/pkg/taskforge"
+)
+
+// fakeManager serves tasks from an in-memory queue. Methods the worker does not
+// use fall through to the embedded nil interface and panic if called.
+type fakeManager struct {
+	taskforge.TaskManager
+
+	mu        sync.Mutex
+	queue     []*model.Task
+	batches   []int
+	extended  map[uuid.UUID]int
+	completed map[uuid.UUID]bool
+	errors    map[uuid.UUID]string
+	cancel    map[uuid.UUID]bool
+	acked     map[uuid.UUID]bool
+	timedOut  map[uuid.UUID]bool
+	released  map[uuid.UUID]bool
+
+	// onReserve, if set, runs before ReserveN returns, which then also
+	// returns reserveErr.
+	onReserve  func()
+	reserveErr error
+}
+
+func newFakeManager(tasks ...*model.Task) *fakeManager {
+	for _, t := range tasks {
+		t.ID = uuid.New()
+	}
+	return &fakeManager{
+		queue:     tasks,
+		extended:  make(map[uuid.UUID]int),
+		completed: make(map[uuid.UUID]bool),
+		errors:    make(map[uuid.UUID]string),
+		cancel:    make(map[uuid.UUID]bool),
+		acked:     make(map[uuid.UUID]bool),
+		timedOut:  make(map[uuid.UUID]bool),
+		released:  make(map[uuid.UUID]bool),
+	}
+}
+
+func (f *fakeManager) ReserveN(ctx context.Context, n int, opts taskforge.ReserveOptions) ([]model.Task, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var reserved []model.Task
+	remaining := f.queue[:0]
+	for _, t := range f.queue {
+		if len(reserved) < n && slices.Contains(opts.Types, t.Type) {
+			reserved = append(reserved, *t)
+			continue
+		}
+		remaining = append(remaining, t)
+	}
+	f.queue = remaining
+	f.batches = append(f.batches, len(reserved))
+	if f.onReserve != nil {
+		f.onReserve()
+	}
+	return reserved, f.reserveErr
+}
+
+func (f *fakeManager) largestBatch() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	largest := 0
+	for _, n := range f.batches {
+		largest = max(largest, n)
+	}
+	return largest
+}
+
+func (f *fakeManager) queued() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.queue)
+}
+
+func (f *fakeManager) Complete(ctx context.Context, id uuid.UUID, success bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.completed[id] = success
+	return nil
+}
+
+func (f *fakeManager) Fail(ctx context.Context, id uuid.UUID, errMsg string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.completed[id] = false
+	f.errors[id] = errMsg
+	return nil
+}
+
+func (f *fakeManager) Release(ctx context.Context, id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.released[id] = true
+	return nil
+}
+
+func (f *fakeManager) wasReleased(id uuid.UUID) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.released[id]
+}
+
+func (f *fakeManager) failure(id uuid.UUID) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.errors[id]
+}
+
+func (f *fakeManager) ExtendLease(ctx context.Context, id uuid.UUID, d time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.extended[id]++
+	return f.cancel[id], nil
+}
+
+func (f *fakeManager) requestCancel(id uuid.UUID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancel[id] = true
+}
+
+// expireCancel simulates the cancellation of id timing out: the task moves to
+// failed_to_cancel, so the manager stops reporting the request.
+func (f *fakeManager) expireCancel(id uuid.UUID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancel[id] = false
+	f.timedOut[id] = true
+}
+
+func (f *fakeManager) AcknowledgeCancel(ctx context.Context, id uuid.UUID, cancelled bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.timedOut[id] {
+		return taskforge.ErrTaskNotCancelling
+	}
+	f.acked[id] = cancelled
+	return nil
+}
+
+func (f *fakeManager) acknowledged(id uuid.UUID) (cancelled, done bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cancelled, done = f.acked[id]
+	return cancelled, done
+}
+
+func (f *fakeManager) extensions(id uuid.UUID) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.extended[id]
+}
+
+func (f *fakeManager) outcome(id uuid.UUID) (success, done bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	success, done = f.completed[id]
+	return success, done
+}
+
+func (f *fakeManager) completedCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.completed)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWorkerDispatchesByType(t *testing.T) {
+	ok := &model.Task{Type: "email"}
+	bad := &model.Task{Type: "email"}
+	panics := &model.Task{Type: "explode"}
+	mgr := newFakeManager(ok, bad, panics)
+
+	w := New(mgr, WithConcurrency(2), WithPollInterval(10*time.Millisecond))
+	w.Handle("email", func(ctx context.Context, task *model.Task) error {
+		if task.ID == bad.ID {
+			return errors.New("smtp unavailable")
+		}
+		return nil
+	})
+	w.Handle("explode", func(ctx context.Context, task *model.Task) error {
+		panic("boom")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	waitFor(t, func() bool { return mgr.completedCount() == 3 })
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		task *model.Task
+		want bool
+	}{
+		{"success", ok, true},
+		{"handler error", bad, false},
+		{"handler panic", panics, false},
+	}
+	for _, tc := range cases {
+		success, done := mgr.outcome(tc.task.ID)
+		if !done {
+			t.Fatalf("%s: task was not completed", tc.name)
+		}
+		if success != tc.want {
+			t.Fatalf("%s: expected success=%v, got %v", tc.name, tc.want, success)
+		}
+	}
+	if msg := mgr.failure(bad.ID); msg != "smtp unavailable" {
+		t.Fatalf("expected the handler error to be recorded, got %q", msg)
+	}
+}
+
+func TestWorkerWaitsForInFlightHandlersOnShutdown(t *testing.T) {
+	task := &model.Task{Type: "slow"}
+	mgr := newFakeManager(task)
+
+	started := make(chan struct{})
+	w := New(mgr, WithPollInterval(10*time.Millisecond))
+	w.Handle("slow", func(ctx context.Context, _ *model.Task) error {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	<-started
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+
+	if _, done := mgr.outcome(task.ID); !done {
+		t.Fatalf("expected in-flight task to be completed before Run returned")
+	}
+}
+
+func TestWorkerReleasesTasksInterruptedByShutdown(t *testing.T) {
+	task := &model.Task{Type: "slow"}
+	mgr := newFakeManager(task)
+
+	started := make(chan struct{})
+	w := New(mgr, WithPollInterval(10*time.Millisecond))
+	w.Handle("slow", func(ctx context.Context, _ *model.Task) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	<-started
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+
+	if _, completed := mgr.outcome(task.ID); completed {
+		t.Fatalf("did not expect a task interrupted by shutdown to be failed, got %q", mgr.failure(task.ID))
+	}
+	if !mgr.wasReleased(task.ID) {
+		t.Fatalf("expected the task to be released back to pending")
+	}
+}
+
+func TestWorkerReleasesTasksReservedDuringShutdown(t *testing.T) {
+	task := &model.Task{Type: "tiny"}
+	mgr := newFakeManager(task)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mgr.onReserve = cancel
+	mgr.reserveErr = context.Canceled
+
+	w := New(mgr, WithPollInterval(10*time.Millisecond))
+	var ran atomic.Bool
+	w.Handle("tiny", func(ctx context.Context, _ *model.Task) error {
+		ran.Store(true)
+		return nil
+	})
+
+	if err := w.Run(ctx); err != nil {
+		t.Fatalf("run returned error: %v", err)
+	}
+	if ran.Load() {
+		t.Fatalf("did not expect a task reserved during shutdown to run")
+	}
+	if !mgr.wasReleased(task.ID) {
+		t.Fatalf("expected the task to be released back to pending")
+	}
+}
+
+func TestWorkerOnlyReservesRegisteredTypes(t *testing.T) {
+	mine := &model.Task{Type: "email"}
+	other := &model.Task{Type: "sms"}
+	mgr := newFakeManager(other, mine)
+
+	w := New(mgr, WithPollInterval(10*time.Millisecond))
+	w.Handle("email", func(ctx context.Context, _ *model.Task) error { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	waitFor(t, func() bool { return mgr.completedCount() == 1 })
+	cancel()
+	<-done
+
+	if _, done := mgr.outcome(mine.ID); !done {
+		t.Fatalf("expected registered task type to be processed")
+	}
+	if _, done := mgr.outcome(other.ID); done {
+		t.Fatalf("did not expect unregistered task type to be reserved")
+	}
+	if mgr.queued() != 1 {
+		t.Fatalf("expected unregistered task to remain queued, got %d queued", mgr.queued())
+	}
+}
+
+func TestWorkerReservesBatchesForIdleSlots(t *testing.T) {
+	tasks := make([]*model.Task, 6)
+	for i := range tasks {
+		tasks[i] = &model.Task{Type: "tiny"}
+	}
+	mgr := newFakeManager(tasks...)
+
+	w := New(mgr, WithConcurrency(3), WithPollInterval(10*time.Millisecond))
+	w.Handle("tiny", func(ctx context.Context, _ *model.Task) error { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	waitFor(t, func() bool { return mgr.completedCount() == len(tasks) })
+	cancel()
+	<-done
+
+	if got := mgr.largestBatch(); got != 3 {
+		t.Fatalf("expected a batch filling all 3 idle slots, largest batch was %d", got)
+	}
+}
+
+func TestWorkerExtendsLeaseWhileHandlerRuns(t *testing.T) {
+	task := &model.Task{Type: "long"}
+	mgr := newFakeManager(task)
+
+	w := New(mgr, WithLease(20*time.Millisecond), WithPollInterval(10*time.Millisecond))
+	w.Handle("long", func(ctx context.Context, _ *model.Task) error {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	waitFor(t, func() bool { return mgr.completedCount() == 1 })
+	cancel()
+	<-done
+
+	if n := mgr.extensions(task.ID); n < 3 {
+		t.Fatalf("expected the lease to be extended repeatedly, got %d extensions", n)
+	}
+}
+
+func TestWorkerCancelsHandlerWhenCancellationRequested(t *testing.T) {
+	task := &model.Task{Type: "long"}
+	mgr := newFakeManager(task)
+
+	started := make(chan struct{})
+	w := New(mgr, WithHeartbeat(10*time.Millisecond), WithPollInterval(10*time.Millisecond))
+	w.Handle("long", func(ctx context.Context, _ *model.Task) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	<-started
+	mgr.requestCancel(task.ID)
+	waitFor(t, func() bool {
+		_, acked := mgr.acknowledged(task.ID)
+		return acked
+	})
+	cancel()
+	<-done
+
+	if cancelled, _ := mgr.acknowledged(task.ID); !cancelled {
+		t.Fatalf("expected the worker to acknowledge the cancellation")
+	}
+	if _, completed := mgr.outcome(task.ID); completed {
+		t.Fatalf("did not expect a cancelled task to be completed")
+	}
+}
+
+func TestWorkerStopsHandlerAtTaskDeadline(t *testing.T) {
+	deadline := time.Now().Add(50 * time.Millisecond)
+	task := &model.Task{Type: "slow", DeadlineAt: &deadline}
+	mgr := newFakeManager(task)
+
+	w := New(mgr, WithPollInterval(10*time.Millisecond))
+	w.Handle("slow", func(ctx context.Context, _ *model.Task) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	waitFor(t, func() bool { return mgr.completedCount() == 1 })
+	cancel()
+	<-done
+
+	if success, _ := mgr.outcome(task.ID); success {
+		t.Fatalf("expected the timed out task to fail")
+	}
+	if msg := mgr.failure(task.ID); msg != context.DeadlineExceeded.Error() {
+		t.Fatalf("expected a deadline failure, got %q", msg)
+	}
+}
+
+func TestWorkerReportsOutcomeAfterCancellationTimesOut(t *testing.T) {
+	task := &model.Task{Type: "stubborn"}
+	mgr := newFakeManager(task)
+
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	finish := make(chan struct{})
+	w := New(mgr, WithHeartbeat(10*time.Millisecond), WithPollInterval(10*time.Millisecond))
+	w.Handle("stubborn", func(ctx context.Context, _ *model.Task) error {
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+		// The handler cannot stop and finishes its work anyway.
+		<-finish
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	<-started
+	mgr.requestCancel(task.ID)
+	<-stopped
+	mgr.expireCancel(task.ID)
+	close(finish)
+
+	waitFor(t, func() bool { return mgr.completedCount() == 1 })
+	cancel()
+	<-done
+
+	if success, _ := mgr.outcome(task.ID); !success {
+		t.Fatalf("expected the task to be completed after its cancellation timed out")
+	}
+	if _, acked := mgr.acknowledged(task.ID); acked {
+		t.Fatalf("did not expect the timed out cancellation to be acknowledged")
+	}
+}